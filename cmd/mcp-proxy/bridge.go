@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/httpclient"
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/proxy"
+	"github.com/sabbour/mcp-proxy-go/internal/stdio"
+	"github.com/sabbour/mcp-proxy-go/internal/websocket"
+)
+
+const bridgeSpecHelp = `Transport specs:
+  stdio                    the proxy's own stdin and stdout
+  cmd:<command> [args...]  launch a stdio server process
+  http(s)://host/mcp       streamable HTTP endpoint
+  sse:http(s)://host/sse   legacy HTTP+SSE endpoint
+  ws(s)://host/ws          WebSocket endpoint
+  unix:<path>              newline-delimited JSON over a unix socket`
+
+// runBridge relays messages between any two transports. The --from side is
+// the client that issues requests and the --to side the server answering
+// them. It exits with 0 when the --from side or a signal ends the relay, 1
+// when the --to side goes away or a transport cannot be started, and 2 on
+// usage errors.
+func runBridge(args []string) int {
+	fs := flag.NewFlagSet("bridge", flag.ContinueOnError)
+	from := fs.String("from", "", "Transport spec of the client side")
+	to := fs.String("to", "", "Transport spec of the server side")
+	apiKey := fs.String("api-key", "", "API key sent as X-API-Key to HTTP, SSE and WebSocket endpoints")
+	bearer := fs.String("bearer-token", "", "Token sent as 'Authorization: Bearer <token>' to HTTP, SSE and WebSocket endpoints")
+	termWait := fs.Duration("terminate-timeout", 5*time.Second, "Time to wait after SIGTERM before killing a launched process group")
+	quiet := fs.Bool("quiet", false, "Suppress all log output on stderr")
+	var headers headerList
+	fs.Var(&headers, "header", "Extra request header as 'Name: value' (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mcp-proxy bridge --from <spec> --to <spec> [flags]")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), bridgeSpecHelp)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *from == "" || *to == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *from == "stdio" && *to == "stdio" {
+		fmt.Fprintln(os.Stderr, "only one side of the bridge can use the proxy's own stdio")
+		return 2
+	}
+
+	// Either side may be the proxy's stdio, so logs only ever go to stderr.
+	log.SetOutput(os.Stderr)
+	if *quiet {
+		log.SetOutput(io.Discard)
+	}
+
+	builder := specBuilder{
+		header:           requestHeader(headers, *apiKey, *bearer),
+		terminateTimeout: *termWait,
+	}
+	var order closeOrder
+
+	client, err := builder.build(*from)
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: --from %s: %v", *from, err)
+		return exitCodeFor(err)
+	}
+	server, err := builder.build(*to)
+	if err != nil {
+		_ = client.Close()
+		log.Printf("[mcp-proxy] ERROR: --to %s: %v", *to, err)
+		return exitCodeFor(err)
+	}
+
+	bridge := proxy.NewBridge(order.watch("from", client), order.watch("to", server))
+	if err := bridge.Start(context.Background()); err != nil {
+		_ = bridge.Close()
+		log.Printf("[mcp-proxy] ERROR: failed to start bridge from %s to %s: %v", *from, *to, err)
+		return 1
+	}
+	log.Printf("[mcp-proxy] INFO: bridging %s to %s", *from, *to)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-bridge.Done():
+	case sig := <-sigCh:
+		log.Printf("[mcp-proxy] INFO: received %s, closing bridge", sig)
+		_ = bridge.Close()
+		return 0
+	}
+
+	if order.side == "to" {
+		log.Printf("[mcp-proxy] ERROR: %s closed the connection", *to)
+		return 1
+	}
+	log.Printf("[mcp-proxy] INFO: %s closed the connection", *from)
+	return 0
+}
+
+// errBadSpec marks spec errors, which are usage errors rather than failures.
+var errBadSpec = errors.New("invalid transport spec")
+
+func exitCodeFor(err error) int {
+	if errors.Is(err, errBadSpec) {
+		return 2
+	}
+	return 1
+}
+
+// specBuilder turns transport specs into transports.
+type specBuilder struct {
+	header           http.Header
+	terminateTimeout time.Duration
+}
+
+func (b specBuilder) build(spec string) (mcp.Transport, error) {
+	scheme, rest, _ := strings.Cut(spec, ":")
+	switch scheme {
+	case "stdio":
+		if rest != "" {
+			return nil, fmt.Errorf("%w: stdio takes no argument", errBadSpec)
+		}
+		return stdio.NewServerTransport(os.Stdin, os.Stdout), nil
+	case "cmd":
+		parts := strings.Fields(rest)
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("%w: cmd: needs a command", errBadSpec)
+		}
+		client := stdio.NewClient(stdio.Params{
+			Command:          parts[0],
+			Args:             parts[1:],
+			TerminateTimeout: b.terminateTimeout,
+		})
+		client.OnExit(func(status stdio.ExitStatus) {
+			if status.Signal != "" {
+				log.Printf("[mcp-proxy] INFO: process %d exited on signal %s", status.PID, status.Signal)
+			} else {
+				log.Printf("[mcp-proxy] INFO: process %d exited with code %d", status.PID, status.Code)
+			}
+		})
+		return client, nil
+	case "http", "https":
+		return httpclient.New(httpclient.Options{URL: spec, Headers: b.header}), nil
+	case "sse":
+		if !strings.HasPrefix(rest, "http://") && !strings.HasPrefix(rest, "https://") {
+			return nil, fmt.Errorf("%w: sse: needs an http(s) URL", errBadSpec)
+		}
+		return httpclient.NewSSE(httpclient.Options{URL: rest, Headers: b.header}), nil
+	case "ws", "wss":
+		return websocket.NewTransport(websocket.TransportOptions{URL: spec, Header: b.header}), nil
+	case "unix":
+		if rest == "" {
+			return nil, fmt.Errorf("%w: unix: needs a socket path", errBadSpec)
+		}
+		conn, err := net.Dial("unix", rest)
+		if err != nil {
+			return nil, err
+		}
+		return stdio.NewConnTransport(conn), nil
+	default:
+		return nil, fmt.Errorf("%w %q", errBadSpec, spec)
+	}
+}
+
+// closeOrder remembers which side of the bridge closed first, since closing
+// one side closes the other as well. side is safe to read once the bridge is
+// done.
+type closeOrder struct {
+	once sync.Once
+	side string
+}
+
+func (o *closeOrder) watch(side string, t mcp.Transport) mcp.Transport {
+	return &watchedTransport{Transport: t, side: side, order: o}
+}
+
+type watchedTransport struct {
+	mcp.Transport
+	side  string
+	order *closeOrder
+}
+
+func (w *watchedTransport) OnClose(fn func()) {
+	w.Transport.OnClose(func() {
+		w.order.once.Do(func() { w.order.side = w.side })
+		fn()
+	})
+}
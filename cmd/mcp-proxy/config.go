@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/config"
+)
+
+// settings is the configuration resolved from the flags and the configuration
+// file. A reload replaces it as a whole, so that a session is always created
+// from one consistent version.
+type settings struct {
+	apiKey           string
+	stateless        bool
+	maxSessions      int
+	idleTimeout      time.Duration
+	maxLifetime      time.Duration
+	terminateTimeout time.Duration
+	cwd              string
+	command          string
+	args             []string
+	env              []string
+	backends         []backendSpec
+	servers          []serverSpec
+}
+
+// servesRoot reports whether the top-level endpoints have a server.
+func (s *settings) servesRoot() bool {
+	return s.command != "" || len(s.backends) > 0
+}
+
+// sameRootProcess reports whether processes started for the top-level
+// server with s are started the same way with o, so that long-lived ones
+// may keep serving new sessions.
+func (s *settings) sameRootProcess(o *settings) bool {
+	return s.command == o.command && s.cwd == o.cwd && s.terminateTimeout == o.terminateTimeout &&
+		slices.Equal(s.args, o.args) && slices.Equal(s.env, o.env) &&
+		slices.EqualFunc(s.backends, o.backends, func(a, b backendSpec) bool {
+			return a.name == b.name && a.prefix == b.prefix && a.command == b.command && slices.Equal(a.args, b.args)
+		})
+}
+
+// configFlags are the flags the configuration file can set.
+var configFlags = []string{
+	"api-key",
+	"max-sessions",
+	"session-idle-timeout",
+	"session-max-lifetime",
+	"terminate-timeout",
+	"shutdown-timeout",
+	"cwd",
+	"stateless",
+}
+
+// listenAddr is a host and port the HTTP server listens on.
+type listenAddr struct {
+	host string
+	port int
+}
+
+// explicitFlags returns the names of the flags given on the command line.
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return explicit
+}
+
+// applyConfig sets the flags not given on the command line from the
+// configuration file, so that flags override the file. Flags the file does
+// not set are reset to their defaults, which undoes an earlier file's values
+// on reload.
+func applyConfig(fs *flag.FlagSet, cfg *config.Config, explicit map[string]bool) error {
+	values := map[string]string{}
+	if cfg.Auth.APIKey != "" {
+		values["api-key"] = cfg.Auth.APIKey
+	}
+	if cfg.Limits.MaxSessions > 0 {
+		values["max-sessions"] = strconv.Itoa(cfg.Limits.MaxSessions)
+	}
+	durations := map[string]time.Duration{
+		"session-idle-timeout": cfg.Limits.SessionIdleTimeout,
+		"session-max-lifetime": cfg.Limits.SessionMaxLifetime,
+		"terminate-timeout":    cfg.Limits.TerminateTimeout,
+		"shutdown-timeout":     cfg.Limits.ShutdownTimeout,
+	}
+	for name, d := range durations {
+		if d > 0 {
+			values[name] = d.String()
+		}
+	}
+	if cfg.Server != nil {
+		if cfg.Server.Cwd != "" {
+			values["cwd"] = cfg.Server.Cwd
+		}
+		if cfg.Server.Stateless {
+			values["stateless"] = "true"
+		}
+	}
+
+	for _, name := range configFlags {
+		if explicit[name] {
+			continue
+		}
+		value, ok := values[name]
+		if !ok {
+			value = fs.Lookup(name).DefValue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config value for --%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// listenAddrs returns the configured listeners, or the --host and --port
+// address when either flag is given or no listener is configured.
+func listenAddrs(cfg *config.Config, explicit map[string]bool, host string, port int) []listenAddr {
+	if cfg == nil || len(cfg.Listeners) == 0 || explicit["host"] || explicit["port"] {
+		return []listenAddr{{host: host, port: port}}
+	}
+	addrs := make([]listenAddr, len(cfg.Listeners))
+	for i, l := range cfg.Listeners {
+		addrs[i] = listenAddr{host: l.Host, port: l.Port}
+		if addrs[i].host == "" {
+			addrs[i].host = host
+		}
+	}
+	return addrs
+}
+
+// configServers adds the configured servers to those given with --server,
+// which win on a name clash.
+func configServers(cfg *config.Config, servers []serverSpec) []serverSpec {
+	given := map[string]bool{}
+	for _, srv := range servers {
+		given[srv.name] = true
+	}
+
+	names := make([]string, 0, len(cfg.Servers))
+	for name := range cfg.Servers {
+		if !given[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		srv := cfg.Servers[name]
+		servers = append(servers, serverSpec{
+			name:      name,
+			command:   srv.Command,
+			args:      srv.Args,
+			env:       srv.EnvList(),
+			cwd:       srv.Cwd,
+			apiKey:    srv.APIKey,
+			stateless: srv.Stateless,
+		})
+	}
+	return servers
+}
+
+// configStamp fingerprints the configuration files by modification time and
+// size, so that polling notices when one of them is edited.
+func configStamp(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", path)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String()
+}
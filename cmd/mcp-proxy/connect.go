@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sabbour/mcp-proxy-go/internal/httpclient"
+	"github.com/sabbour/mcp-proxy-go/internal/proxy"
+	"github.com/sabbour/mcp-proxy-go/internal/stdio"
+)
+
+// headerList collects repeated --header flags.
+type headerList []string
+
+func (h *headerList) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerList) Set(value string) error {
+	if _, _, ok := strings.Cut(value, ":"); !ok {
+		return fmt.Errorf("header %q must be in the form 'Name: value'", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// requestHeader combines the --header, --api-key and --bearer-token flags
+// into the headers sent to a remote server.
+func requestHeader(headers headerList, apiKey, bearer string) http.Header {
+	header := http.Header{}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if apiKey != "" {
+		header.Set("X-API-Key", apiKey)
+	}
+	if bearer != "" {
+		header.Set("Authorization", "Bearer "+bearer)
+	}
+	return header
+}
+
+// runConnect exposes a remote streamable HTTP MCP server on the proxy's own
+// stdin and stdout, for clients that can only launch stdio servers.
+func runConnect(args []string) int {
+	fs := flag.NewFlagSet("connect", flag.ContinueOnError)
+	apiKey := fs.String("api-key", "", "API key sent as X-API-Key")
+	bearer := fs.String("bearer-token", "", "Token sent as 'Authorization: Bearer <token>'")
+	retries := fs.Int("max-retries", 3, "Retries for failed requests and expired sessions")
+	quiet := fs.Bool("quiet", false, "Suppress all log output on stderr")
+	var headers headerList
+	fs.Var(&headers, "header", "Extra request header as 'Name: value' (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mcp-proxy connect [flags] <url>")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	// Allow flags after the URL as well.
+	rest := fs.Args()
+	if len(rest) > 1 {
+		if err := fs.Parse(rest[1:]); err != nil {
+			return 2
+		}
+		rest = append(rest[:1], fs.Args()...)
+	}
+	if len(rest) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	// Stdout carries the protocol, so logs only ever go to stderr.
+	log.SetOutput(os.Stderr)
+	if *quiet {
+		log.SetOutput(io.Discard)
+	}
+
+	remote := httpclient.New(httpclient.Options{
+		URL:        rest[0],
+		Headers:    requestHeader(headers, *apiKey, *bearer),
+		MaxRetries: *retries,
+	})
+	local := stdio.NewServerTransport(os.Stdin, os.Stdout)
+	bridge := proxy.NewBridge(local, remote)
+
+	if err := bridge.Start(context.Background()); err != nil {
+		log.Printf("[mcp-proxy] ERROR: failed to connect to %s: %v", rest[0], err)
+		return 1
+	}
+	log.Printf("[mcp-proxy] INFO: relaying stdio to %s", rest[0])
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-bridge.Done():
+	case <-sigCh:
+		_ = bridge.Close()
+	}
+	return 0
+}
@@ -5,7 +5,7 @@
 //
 // Original work Copyright (c) 2024 punkpeye
 // Go port implementation generated with AI assistance
-// 
+//
 // This implementation adapts the core architecture and API design from the
 // original TypeScript project to provide HTTP/SSE access to stdio-based MCP servers.
 package main
@@ -13,20 +13,30 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/sabbour/mcp-proxy-go/internal/config"
 	"github.com/sabbour/mcp-proxy-go/internal/eventstore"
+	"github.com/sabbour/mcp-proxy-go/internal/gateway"
 	"github.com/sabbour/mcp-proxy-go/internal/httpserver"
 	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/proxy"
+	"github.com/sabbour/mcp-proxy-go/internal/registry"
 	"github.com/sabbour/mcp-proxy-go/internal/stdio"
 )
 
@@ -38,20 +48,63 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "connect":
+			os.Exit(runConnect(os.Args[2:]))
+		case "bridge":
+			os.Exit(runBridge(os.Args[2:]))
+		}
+	}
+
 	var (
-		host      = flag.String("host", "0.0.0.0", "Host interface to bind the HTTP server")
-		port      = flag.Int("port", 3000, "Port for the HTTP server")
-		apiKey    = flag.String("api-key", "", "Optional API key required for incoming requests")
-		command   = flag.String("command", "", "Command to launch the MCP server over stdio")
-		argsList  = flag.String("args", "", "Comma-separated list of arguments for the command")
-		cwd       = flag.String("cwd", "", "Working directory for the launched command")
-		envList   = flag.String("env", "", "Comma-separated list of KEY=VALUE pairs to add to the environment")
-		stateless = flag.Bool("stateless", false, "Enable stateless mode (no session reuse)")
-		verbose   = flag.Bool("verbose", false, "Enable verbose debug logging")
-		quiet     = flag.Bool("quiet", false, "Suppress all debug output except errors")
-		version   = flag.Bool("version", false, "Show version information")
+		host       = flag.String("host", "0.0.0.0", "Host interface to bind the HTTP server")
+		port       = flag.Int("port", 3000, "Port for the HTTP server")
+		apiKey     = flag.String("api-key", "", "Optional API key required for incoming requests")
+		command    = flag.String("command", "", "Command to launch the MCP server over stdio")
+		argsList   = flag.String("args", "", "Comma-separated list of arguments for the command")
+		cwd        = flag.String("cwd", "", "Working directory for the launched command")
+		envList    = flag.String("env", "", "Comma-separated list of KEY=VALUE pairs to add to the environment")
+		stateless  = flag.Bool("stateless", false, "Enable stateless mode (no session reuse)")
+		jsonResp   = flag.Bool("json-response", false, "Always answer POST requests with JSON instead of SSE streams")
+		idleTTL    = flag.Duration("session-idle-timeout", 0, "Close sessions idle for this long (0 disables)")
+		maxLife    = flag.Duration("session-max-lifetime", 0, "Close sessions this long after creation (0 disables)")
+		maxSess    = flag.Int("max-sessions", 0, "Maximum number of concurrent sessions (0 means unlimited)")
+		termWait   = flag.Duration("terminate-timeout", 5*time.Second, "Time to wait after SIGTERM before killing the server process group")
+		restart    = flag.Bool("restart", false, "Restart the server process when it crashes instead of ending the session")
+		maxRestart = flag.Int("max-restarts", 5, "Restarts allowed per minute before a crashing server is given up")
+		backoff    = flag.Duration("restart-backoff", 500*time.Millisecond, "Initial delay before restarting a crashed server; doubles per restart")
+		shared     = flag.Int("shared-backends", 0, "Serve all sessions from this many long-lived server processes (0 starts one per session)")
+		poolSize   = flag.Int("pool-size", 0, "Keep this many started server processes ready for new sessions (0 disables)")
+		poolMax    = flag.Int("pool-max-processes", 0, "Cap on pooled and in-use server processes (0 means unlimited)")
+		poolInit   = flag.Bool("pool-preinitialize", false, "Run the initialize handshake on pooled processes before they are handed out")
+		wsPing     = flag.Duration("ws-ping-interval", 30*time.Second, "Interval between WebSocket pings; clients silent for two intervals are dropped")
+		wsOrigins  = flag.String("ws-allowed-origins", "", "Comma-separated hosts (e.g. app.example.com, *.example.com) whose pages may open WebSockets besides the proxy's own")
+		evMax      = flag.Int("event-max-per-session", 1000, "Events kept per session for resuming streams (0 means unlimited)")
+		evBytes    = flag.Int64("event-max-bytes", 64<<20, "Total payload bytes kept for resuming streams across sessions (0 means unlimited)")
+		evTTL      = flag.Duration("event-ttl", time.Hour, "Drop events kept for resuming streams after this long (0 disables)")
+		evDir      = flag.String("event-store-dir", "", "Persist events for resuming streams in this directory so they survive restarts (default keeps them in memory)")
+		evSync     = flag.String("event-fsync", "interval", "When the event store directory is synced to disk: always, interval (every second) or never")
+		regDir     = flag.String("registry-dir", "", "Directory shared by replicas recording which one owns each session; requests for another replica's session are forwarded to it")
+		advertise  = flag.String("advertise-url", "", "Base URL other replicas reach this one at (default http://<hostname>:<port>)")
+		grace      = flag.Duration("shutdown-timeout", 10*time.Second, "Grace period for in-flight requests and child processes on shutdown")
+		verbose    = flag.Bool("verbose", false, "Enable verbose debug logging")
+		quiet      = flag.Bool("quiet", false, "Suppress all debug output except errors")
+		version    = flag.Bool("version", false, "Show version information")
+		configPath = flag.String("config", "", "YAML or JSON configuration file; flags given on the command line override it")
+		configPoll = flag.Duration("config-poll-interval", 2*time.Second, "How often to check the config file for changes to reload (0 disables; SIGHUP always reloads)")
 	)
 
+	var backendSpecs, backendPrefixes stringList
+	flag.Var(&backendSpecs, "backend", "Aggregate a server into a gateway as 'name=command args' (repeatable)")
+	flag.Var(&backendPrefixes, "backend-prefix", "Tool and prompt name prefix for a backend as 'name=prefix' (default 'name_')")
+
+	var serverSpecs, serverEnvs, serverKeys, serverStateless stringList
+	flag.Var(&serverSpecs, "server", "Mount a server at /servers/<name>/mcp as 'name=command args' (repeatable)")
+	flag.Var(&serverEnvs, "server-env", "Environment entry for a mounted server as 'name=KEY=VALUE' (repeatable)")
+	flag.Var(&serverKeys, "server-api-key", "API key for a mounted server as 'name=key', replacing --api-key (repeatable)")
+	flag.Var(&serverStateless, "server-stateless", "Serve the named mounted server in stateless mode (repeatable)")
+
 	flag.Parse()
 
 	// Handle version flag
@@ -97,81 +150,271 @@ func main() {
 		log.SetOutput(os.Stderr)
 	}
 
+	explicit := explicitFlags(flag.CommandLine)
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err == nil {
+			err = applyConfig(flag.CommandLine, cfg, explicit)
+		}
+		if err != nil {
+			logError("failed to load config: %v", err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		logInfo("loaded config from %s", *configPath)
+	}
+
 	logDebug("Starting with command=%s, args=%s, port=%d, host=%s", *command, *argsList, *port, *host)
 
-	if *command == "" {
-		logError("--command is required")
-		fmt.Fprintln(os.Stderr, "--command is required")
+	backends, err := parseBackends(backendSpecs, backendPrefixes)
+	if err != nil {
+		logError("%v", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
 
-	args := splitCommaList(*argsList)
-	env := splitCommaList(*envList)
-
-	// Parse the command to separate the executable from its arguments
-	cmdParts := strings.Fields(*command)
-	if len(cmdParts) == 0 {
-		log.Println("[mcp-proxy] ERROR: --command is empty")
-		fmt.Fprintln(os.Stderr, "--command is empty")
+	flagServers, err := parseServers(serverSpecs, serverEnvs, serverKeys, serverStateless)
+	if err != nil {
+		logError("%v", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
-	
-	actualCommand := cmdParts[0]
-	cmdArgs := cmdParts[1:]
-	
-	// If args were provided via -args flag, append them to the command args
-	if len(args) > 0 {
-		cmdArgs = append(cmdArgs, args...)
+
+	// resolve combines the flags with the configuration file, whose values
+	// applyConfig has written into the flags not given explicitly.
+	resolve := func(cfg *config.Config) (*settings, error) {
+		s := &settings{
+			apiKey:           *apiKey,
+			stateless:        *stateless,
+			maxSessions:      *maxSess,
+			idleTimeout:      *idleTTL,
+			maxLifetime:      *maxLife,
+			terminateTimeout: *termWait,
+			cwd:              *cwd,
+			env:              splitCommaList(*envList),
+			backends:         backends,
+			servers:          flagServers,
+		}
+
+		// The configured top-level server applies unless --command or
+		// --backend replace it.
+		var configured *config.Server
+		if cfg != nil {
+			s.servers = configServers(cfg, flagServers)
+			if cfg.Server != nil && *command == "" && len(backends) == 0 {
+				configured = cfg.Server
+			}
+		}
+
+		if *command == "" && configured == nil && len(backends) == 0 && len(s.servers) == 0 {
+			return nil, errors.New("--command is required")
+		}
+		if *command != "" && len(backends) > 0 {
+			return nil, errors.New("--command cannot be combined with --backend")
+		}
+
+		// Parse the command to separate the executable from its arguments
+		cmdParts := strings.Fields(*command)
+		if *command != "" && len(cmdParts) == 0 {
+			return nil, errors.New("--command is empty")
+		}
+		if len(cmdParts) > 0 {
+			s.command = cmdParts[0]
+			s.args = cmdParts[1:]
+		}
+		if configured != nil {
+			s.command = configured.Command
+			s.args = append([]string(nil), configured.Args...)
+			s.env = append(s.env, configured.EnvList()...)
+		}
+
+		// If args were provided via -args flag, append them to the command args
+		s.args = append(s.args, splitCommaList(*argsList)...)
+		return s, nil
+	}
+
+	initial, err := resolve(cfg)
+	if err != nil {
+		logError("%v", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
+	// current holds the settings new sessions are created with. Reloading
+	// the configuration replaces it; running processes keep the parameters
+	// they were started with, while shared and warm pooled processes are
+	// replaced when the top-level server changed.
+	var current atomic.Pointer[settings]
+	current.Store(initial)
+
 	if *verbose {
-		logDebug("Parsed command: %s", actualCommand)
-		logDebug("Parsed command args: %v", cmdArgs)
-		logDebug("Parsed env: %v", env)
+		logDebug("Parsed command: %s", initial.command)
+		logDebug("Parsed command args: %v", initial.args)
+		logDebug("Parsed env: %v", initial.env)
 	}
 
-	server, err := httpserver.Start(httpserver.Options{
-		Host:   *host,
-		Port:   *port,
-		APIKey: *apiKey,
-		CreateTransport: func(ctx context.Context, req *http.Request) (mcp.Transport, error) {
-			if *verbose {
-				logDebug("Creating transport for request from %s to %s", req.RemoteAddr, req.URL.Path)
+	logExit := func(status stdio.ExitStatus) {
+		if status.Signal != "" {
+			logInfo("server process %d exited on signal %s", status.PID, status.Signal)
+		} else {
+			logInfo("server process %d exited with code %d", status.PID, status.Code)
+		}
+	}
+
+	newProcess := func(s *settings, params stdio.Params) mcp.Transport {
+		if params.Dir == "" {
+			params.Dir = s.cwd
+		}
+		params.TerminateTimeout = s.terminateTimeout
+		if *verbose {
+			logDebug("Creating stdio client with params: %+v", params)
+		}
+		if *restart {
+			supervisor := stdio.NewSupervisor(params, stdio.SupervisorOptions{
+				InitialBackoff: *backoff,
+				MaxRestarts:    *maxRestart,
+			})
+			supervisor.OnExit(logExit)
+			return supervisor
+		}
+		client := stdio.NewClient(params)
+		client.OnExit(logExit)
+		return client
+	}
+
+	newServerTransport := func() mcp.Transport {
+		s := current.Load()
+		if len(s.backends) > 0 {
+			// Each session gets its own gateway over its own processes.
+			gatewayBackends := make([]gateway.Backend, len(s.backends))
+			for i, b := range s.backends {
+				gatewayBackends[i] = gateway.Backend{
+					Name:      b.name,
+					Prefix:    b.prefix,
+					Transport: newProcess(s, stdio.Params{Command: b.command, Args: b.args, Env: s.env}),
+				}
 			}
-			params := stdio.Params{
-				Command: actualCommand,
-				Args:    cmdArgs,
-				Dir:     *cwd,
-				Env:     env,
+			return gateway.New(gatewayBackends...)
+		}
+		return newProcess(s, stdio.Params{Command: s.command, Args: s.args, Env: s.env})
+	}
+
+	// The top-level endpoints serve --command or the gateway; with only
+	// --server given they serve nothing.
+	if !initial.servesRoot() && (*shared > 0 || *poolSize > 0 || *poolMax > 0) {
+		logError("--shared-backends and --pool-size need --command or --backend")
+		os.Exit(2)
+	}
+
+	// In shared mode a fixed set of long-lived server processes serves every
+	// session instead of one process per session.
+	var mux *proxy.Mux
+	if *shared > 0 {
+		backends := make([]mcp.Transport, *shared)
+		for i := range backends {
+			backends[i] = newServerTransport()
+		}
+		mux = proxy.NewMux(backends...)
+		if err := mux.Start(context.Background()); err != nil {
+			log.Fatalf("[mcp-proxy] ERROR: failed to start shared backends: %v", err)
+		}
+		logInfo("serving all sessions from %d shared server process(es)", *shared)
+	}
+
+	// A pool keeps started processes ready so sessions skip the server's
+	// start-up time.
+	var pool *stdio.Pool
+	if *poolSize > 0 || *poolMax > 0 {
+		if mux != nil {
+			logError("--pool-size cannot be combined with --shared-backends")
+			os.Exit(2)
+		}
+		pool = stdio.NewPool(newServerTransport, stdio.PoolOptions{
+			Size:         *poolSize,
+			MaxProcesses: *poolMax,
+			Initialize:   *poolInit,
+		})
+		pool.Start()
+	}
+
+	createTransport := func(ctx context.Context, req *http.Request) (mcp.Transport, error) {
+		if *verbose {
+			logDebug("Creating transport for request from %s to %s", req.RemoteAddr, req.URL.Path)
+		}
+		if mux != nil {
+			conn, err := mux.Attach()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", httpserver.ErrUnavailable, err)
 			}
-			if *verbose {
-				logDebug("Creating stdio client with params: %+v", params)
+			return conn, nil
+		}
+		if pool != nil {
+			transport, err := pool.Get(ctx)
+			if errors.Is(err, stdio.ErrPoolExhausted) {
+				return nil, fmt.Errorf("%w: %v", httpserver.ErrUnavailable, err)
 			}
-			transport := stdio.NewClient(params)
-			if *verbose {
-				logDebug("Successfully created stdio client")
+			return transport, err
+		}
+		return newServerTransport(), nil
+	}
+
+	// All sessions share one store so that its limits bound the whole
+	// process; each session's stream is deleted when it closes.
+	var events eventstore.EventStore = eventstore.NewMemoryWithOptions(eventstore.MemoryOptions{
+		MaxEventsPerStream: *evMax,
+		MaxBytes:           *evBytes,
+		TTL:                *evTTL,
+	})
+	if *evDir != "" {
+		store, err := eventstore.OpenFile(eventstore.FileOptions{
+			Dir:                *evDir,
+			Sync:               eventstore.SyncPolicy(*evSync),
+			MaxEventsPerStream: *evMax,
+			MaxBytes:           *evBytes,
+			TTL:                *evTTL,
+		})
+		if err != nil {
+			log.Fatalf("[mcp-proxy] ERROR: failed to open event store: %v", err)
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				logError("failed to close event store: %v", err)
+			}
+		}()
+		stats := store.Stats()
+		logInfo("event store %s holds %d event(s) in %d stream(s)", *evDir, stats.Events, stats.Streams)
+		events = store
+	}
+
+	opts := httpserver.Options{
+		Metrics: func(w io.Writer) {
+			writeEventStoreMetrics(w, events.Stats())
+			if pool != nil {
+				writePoolMetrics(w, pool.Stats())
 			}
-			return transport, nil
 		},
-		EventStoreFactory: func() *eventstore.Memory {
-			return eventstore.NewMemory()
+		EventStoreFactory: func() eventstore.EventStore {
+			return events
 		},
-		Stateless: *stateless,
+		EnableJSONResponse:    *jsonResp,
+		WebSocketPingInterval: *wsPing,
+		WebSocketOrigins:      splitCommaList(*wsOrigins),
 		OnConnect: func(sessionID string) {
 			if *verbose {
 				logDebug("session %s connected", sessionID)
 			}
 		},
-		OnClose: func(sessionID string) {
+		OnClose: func(sessionID string, reason httpserver.CloseReason) {
 			if *verbose {
-				logDebug("session %s closed", sessionID)
+				logDebug("session %s closed (%s)", sessionID, reason)
 			}
 		},
 		OnUnhandled: func(w http.ResponseWriter, r *http.Request) {
 			if *verbose {
 				logDebug("Unhandled request: %s %s", r.Method, r.URL.Path)
 				logDebug("Request headers: %+v", r.Header)
-				
+
 				// Log request body for POST requests
 				if r.Method == "POST" {
 					if body, err := io.ReadAll(r.Body); err == nil {
@@ -181,26 +424,363 @@ func main() {
 					}
 				}
 			}
-			
+
 			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(fmt.Sprintf("Endpoint not found: %s %s. Try /mcp", r.Method, r.URL.Path)))
+			_, _ = fmt.Fprintf(w, "Endpoint not found: %s %s. Try /mcp", r.Method, r.URL.Path)
 		},
-	})
-	if err != nil {
-		logError("failed to start http server: %v", err)
-		log.Fatalf("[mcp-proxy] ERROR: failed to start http server: %v", err)
 	}
 
-	logInfo("listening on %s:%d", *host, *port)
+	// applySettings sets the options Reload can change. Every mounted server
+	// starts one process per session with its own environment on top of
+	// --env.
+	applySettings := func(s *settings) {
+		opts.APIKey = s.apiKey
+		opts.Stateless = s.stateless
+		opts.MaxSessions = s.maxSessions
+		opts.SessionIdleTimeout = s.idleTimeout
+		opts.SessionMaxLifetime = s.maxLifetime
+		opts.TerminateTimeout = s.terminateTimeout
+		opts.CreateTransport = nil
+		if s.servesRoot() {
+			opts.CreateTransport = createTransport
+		}
+
+		opts.Routes = make([]httpserver.Route, len(s.servers))
+		for i, srv := range s.servers {
+			opts.Routes[i] = httpserver.Route{
+				Name:      srv.name,
+				APIKey:    srv.apiKey,
+				Stateless: srv.stateless,
+				CreateTransport: func(ctx context.Context, req *http.Request) (mcp.Transport, error) {
+					return newProcess(s, stdio.Params{
+						Command: srv.command,
+						Args:    srv.args,
+						Dir:     srv.cwd,
+						Env:     append(append([]string(nil), s.env...), srv.env...),
+					}), nil
+				},
+			}
+			logInfo("mounted %s at /servers/%s/mcp", srv.command, srv.name)
+		}
+	}
+	applySettings(initial)
+
+	addrs := listenAddrs(cfg, explicit, *host, *port)
+
+	var sessions *registry.File
+	if *regDir != "" {
+		if *advertise != "" && len(addrs) > 1 {
+			logError("--advertise-url cannot be combined with several listeners")
+			os.Exit(2)
+		}
+		sessions, err = registry.NewFile(*regDir)
+		if err != nil {
+			log.Fatalf("[mcp-proxy] ERROR: failed to open session registry: %v", err)
+		}
+		opts.Registry = sessions
+	}
+
+	// Every listener serves the same servers with its own sessions.
+	var httpServers []*httpserver.Server
+	for _, addr := range addrs {
+		opts.Host, opts.Port = addr.host, addr.port
+		if sessions != nil {
+			opts.AdvertiseURL = *advertise
+			if opts.AdvertiseURL == "" {
+				opts.AdvertiseURL = defaultAdvertiseURL(addr)
+			}
+			// Sessions a crashed earlier run left behind are gone.
+			if n, err := sessions.RemoveOwner(opts.AdvertiseURL); err != nil {
+				logError("failed to clean session registry: %v", err)
+			} else if n > 0 {
+				logInfo("removed %d stale session(s) of %s from the registry", n, opts.AdvertiseURL)
+			}
+			logInfo("advertising %s in session registry %s", opts.AdvertiseURL, *regDir)
+		}
+		server, err := httpserver.Start(opts)
+		if err != nil {
+			logError("failed to start http server: %v", err)
+			log.Fatalf("[mcp-proxy] ERROR: failed to start http server: %v", err)
+		}
+		httpServers = append(httpServers, server)
+		logInfo("listening on %s:%d", addr.host, addr.port)
+	}
+
+	// recycleProcesses replaces the long-lived shared and pooled processes
+	// after the top-level server's command or environment changed. Sessions
+	// already attached to a shared process keep it until they end.
+	recycleProcesses := func() {
+		if mux != nil {
+			backends := make([]mcp.Transport, *shared)
+			for i := range backends {
+				backends[i] = newServerTransport()
+			}
+			if err := mux.Recycle(context.Background(), backends...); err != nil {
+				logError("failed to start shared backends with the reloaded config, keeping the old ones until restart: %v", err)
+			} else {
+				logInfo("restarted %d shared server process(es); existing sessions keep the old ones until they end", *shared)
+			}
+		}
+		if pool != nil {
+			if err := pool.Flush(); err != nil {
+				logError("failed to flush pooled processes: %v", err)
+			} else {
+				logInfo("replaced warm pooled processes with the reloaded server command")
+			}
+		}
+	}
+
+	// reload validates the configuration file and applies it to new
+	// sessions. Anything wrong keeps the current configuration.
+	reload := func() {
+		next, err := config.Load(*configPath)
+		var s *settings
+		if err == nil {
+			err = applyConfig(flag.CommandLine, next, explicit)
+			if err == nil {
+				s, err = resolve(next)
+			}
+			if err == nil && !s.servesRoot() && (mux != nil || pool != nil) {
+				err = errors.New("--shared-backends and --pool-size need a top-level server")
+			}
+			if err != nil {
+				_ = applyConfig(flag.CommandLine, cfg, explicit)
+			}
+		}
+		if err != nil {
+			logError("config reload failed, keeping the current configuration: %v", err)
+			return
+		}
+
+		if !explicit["host"] && !explicit["port"] && !slices.Equal(cfg.Listeners, next.Listeners) {
+			logInfo("listener changes take effect on restart")
+		}
+		previous := current.Swap(s)
+		applySettings(s)
+		if !s.sameRootProcess(previous) {
+			recycleProcesses()
+		}
+		for _, server := range httpServers {
+			if err := server.Reload(opts); err != nil {
+				logError("failed to apply reloaded config: %v", err)
+			}
+		}
+		cfg = next
+		logInfo("reloaded config from %s", *configPath)
+	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	var poll <-chan time.Time
+	var stamp string
+	if *configPath != "" && *configPoll > 0 {
+		ticker := time.NewTicker(*configPoll)
+		defer ticker.Stop()
+		poll = ticker.C
+		stamp = configStamp(cfg.Sources)
+	}
+
+wait:
+	for {
+		select {
+		case <-hupCh:
+			if *configPath == "" {
+				logInfo("received SIGHUP without --config, nothing to reload")
+				continue
+			}
+			logInfo("received SIGHUP, reloading config")
+			reload()
+			stamp = configStamp(cfg.Sources)
+		case <-poll:
+			if configStamp(cfg.Sources) == stamp {
+				continue
+			}
+			logInfo("config file changed, reloading")
+			reload()
+			// A failed reload is not retried until the files change again.
+			stamp = configStamp(cfg.Sources)
+		case <-sigCh:
+			break wait
+		}
+	}
 
 	logInfo("shutting down")
-	if err := server.Close(context.Background()); err != nil {
-		logError("shutdown error: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), *grace)
+	defer cancel()
+	for _, server := range httpServers {
+		if err := server.Close(ctx); err != nil {
+			logError("shutdown error: %v", err)
+		}
+	}
+	if pool != nil {
+		if err := pool.Close(); err != nil {
+			logError("failed to stop pooled processes: %v", err)
+		}
+	}
+	if mux != nil {
+		if err := mux.Close(); err != nil {
+			logError("failed to stop shared backends: %v", err)
+		}
+	}
+}
+
+func writePoolMetrics(w io.Writer, stats stdio.PoolStats) {
+	fmt.Fprintln(w, "# HELP mcp_proxy_pool_hits_total Sessions served by a pre-started process.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_pool_hits_total counter")
+	fmt.Fprintf(w, "mcp_proxy_pool_hits_total %d\n", stats.Hits)
+	fmt.Fprintln(w, "# HELP mcp_proxy_pool_misses_total Sessions that had to start a process.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_pool_misses_total counter")
+	fmt.Fprintf(w, "mcp_proxy_pool_misses_total %d\n", stats.Misses)
+	fmt.Fprintln(w, "# HELP mcp_proxy_pool_initialized_total Sessions answered from a pre-initialized process.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_pool_initialized_total counter")
+	fmt.Fprintf(w, "mcp_proxy_pool_initialized_total %d\n", stats.Initialized)
+	fmt.Fprintln(w, "# HELP mcp_proxy_pool_warm Started processes waiting in the pool.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_pool_warm gauge")
+	fmt.Fprintf(w, "mcp_proxy_pool_warm %d\n", stats.Warm)
+	fmt.Fprintln(w, "# HELP mcp_proxy_pool_processes Pooled and in-use server processes.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_pool_processes gauge")
+	fmt.Fprintf(w, "mcp_proxy_pool_processes %d\n", stats.Running)
+}
+
+// defaultAdvertiseURL is the URL other replicas reach a listener at when
+// --advertise-url is not given: its host, or the machine's hostname when it
+// listens on every interface.
+func defaultAdvertiseURL(addr listenAddr) string {
+	host := addr.host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(addr.port))
+}
+
+func writeEventStoreMetrics(w io.Writer, stats eventstore.Stats) {
+	fmt.Fprintln(w, "# HELP mcp_proxy_event_store_events Events kept for resuming streams.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_event_store_events gauge")
+	fmt.Fprintf(w, "mcp_proxy_event_store_events %d\n", stats.Events)
+	fmt.Fprintln(w, "# HELP mcp_proxy_event_store_bytes Payload bytes kept for resuming streams.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_event_store_bytes gauge")
+	fmt.Fprintf(w, "mcp_proxy_event_store_bytes %d\n", stats.Bytes)
+	fmt.Fprintln(w, "# HELP mcp_proxy_event_store_evicted_total Events dropped by the retention limits.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_event_store_evicted_total counter")
+	fmt.Fprintf(w, "mcp_proxy_event_store_evicted_total %d\n", stats.Evicted)
+}
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// backendSpec is a server aggregated by the gateway.
+type backendSpec struct {
+	name    string
+	prefix  string
+	command string
+	args    []string
+}
+
+// parseBackends parses the --backend 'name=command args' and
+// --backend-prefix 'name=prefix' flags.
+func parseBackends(specs, prefixes []string) ([]backendSpec, error) {
+	var backends []backendSpec
+	seen := map[string]int{}
+	for _, spec := range specs {
+		name, command, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(command)
+		if !ok || name == "" || len(fields) == 0 {
+			return nil, fmt.Errorf("--backend %q must be in the form 'name=command args'", spec)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("duplicate backend name %q", name)
+		}
+		seen[name] = len(backends)
+		backends = append(backends, backendSpec{name: name, prefix: name + "_", command: fields[0], args: fields[1:]})
+	}
+
+	for _, p := range prefixes {
+		name, prefix, ok := strings.Cut(p, "=")
+		i, known := seen[strings.TrimSpace(name)]
+		if !ok || !known {
+			return nil, fmt.Errorf("--backend-prefix %q must be 'name=prefix' for a configured backend", p)
+		}
+		backends[i].prefix = prefix
+	}
+	return backends, nil
+}
+
+// serverSpec is a server mounted at its own path.
+type serverSpec struct {
+	name      string
+	command   string
+	args      []string
+	env       []string
+	cwd       string
+	apiKey    string
+	stateless bool
+}
+
+// parseServers parses the --server 'name=command args' flags and the
+// per-server --server-env, --server-api-key and --server-stateless flags.
+func parseServers(specs, envs, keys, stateless []string) ([]serverSpec, error) {
+	var servers []serverSpec
+	seen := map[string]int{}
+	for _, spec := range specs {
+		name, command, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(command)
+		if !ok || name == "" || strings.Contains(name, "/") || len(fields) == 0 {
+			return nil, fmt.Errorf("--server %q must be in the form 'name=command args'", spec)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("duplicate server name %q", name)
+		}
+		seen[name] = len(servers)
+		servers = append(servers, serverSpec{name: name, command: fields[0], args: fields[1:]})
+	}
+
+	lookup := func(flagName, value string) (int, string, error) {
+		name, rest, ok := strings.Cut(value, "=")
+		i, known := seen[strings.TrimSpace(name)]
+		if !ok || !known {
+			return 0, "", fmt.Errorf("--%s %q must be 'name=...' for a configured server", flagName, value)
+		}
+		return i, rest, nil
+	}
+	for _, e := range envs {
+		i, entry, err := lookup("server-env", e)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(entry, "=") {
+			return nil, fmt.Errorf("--server-env %q must be 'name=KEY=VALUE'", e)
+		}
+		servers[i].env = append(servers[i].env, entry)
+	}
+	for _, k := range keys {
+		i, key, err := lookup("server-api-key", k)
+		if err != nil {
+			return nil, err
+		}
+		servers[i].apiKey = key
+	}
+	for _, name := range stateless {
+		i, known := seen[strings.TrimSpace(name)]
+		if !known {
+			return nil, fmt.Errorf("--server-stateless %q names no configured server", name)
+		}
+		servers[i].stateless = true
 	}
+	return servers, nil
 }
 
 func splitCommaList(value string) []string {
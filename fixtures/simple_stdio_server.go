@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -76,6 +78,38 @@ func main() {
 					},
 				},
 			}
+		case "tools/call":
+			var params struct {
+				Meta struct {
+					ProgressToken json.RawMessage `json:"progressToken"`
+				} `json:"_meta"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+
+			if len(params.Meta.ProgressToken) > 0 {
+				for step := 1; step <= 2; step++ {
+					progress := map[string]any{
+						"jsonrpc": "2.0",
+						"method":  "notifications/progress",
+						"params": map[string]any{
+							"progressToken": params.Meta.ProgressToken,
+							"progress":      step,
+							"total":         2,
+						},
+					}
+					if err := json.NewEncoder(os.Stdout).Encode(progress); err != nil {
+						return
+					}
+				}
+			}
+
+			resp["result"] = map[string]any{
+				"content": []any{
+					map[string]any{"type": "text", "text": "done"},
+				},
+			}
+		case "test/crash":
+			os.Exit(1)
 		case "resources/subscribe", "resources/unsubscribe":
 			resp["result"] = map[string]any{}
 		default:
@@ -88,5 +122,21 @@ func main() {
 		if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
 			return
 		}
+
+		if req.Method == "resources/subscribe" {
+			var params struct {
+				URI string `json:"uri"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+
+			notification := map[string]any{
+				"jsonrpc": "2.0",
+				"method":  "notifications/resources/updated",
+				"params":  map[string]any{"uri": params.URI},
+			}
+			if err := json.NewEncoder(os.Stdout).Encode(notification); err != nil {
+				return
+			}
+		}
 	}
 }
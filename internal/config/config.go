@@ -0,0 +1,234 @@
+// Package config loads the proxy's configuration file.
+//
+// The file is YAML or JSON and describes the listeners, the server behind the
+// top-level endpoints, further servers mounted under /servers/<name>, auth and
+// limits. String values may reference environment variables as ${NAME} or
+// ${NAME:-default}, and secrets (API keys and env values) may be read from a
+// file with "file:<path>". Claude Desktop and VS Code configurations can be
+// loaded as they are, or imported, since their mcpServers and servers blocks
+// have the same shape as Servers.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of a configuration file.
+type Config struct {
+	Listeners []Listener `yaml:"listeners"`
+	Auth      Auth       `yaml:"auth"`
+	Limits    Limits     `yaml:"limits"`
+
+	// Server is served at the top-level endpoints such as /mcp.
+	Server *Server `yaml:"server"`
+	// Servers are mounted at /servers/<name>/mcp. The mcpServers blocks of
+	// imported files and of the file itself are merged in; servers defined
+	// under servers win over both.
+	Servers map[string]Server `yaml:"servers"`
+	// MCPServers is the Claude Desktop spelling of Servers.
+	MCPServers map[string]Server `yaml:"mcpServers"`
+	// Import lists Claude Desktop or VS Code configuration files whose
+	// servers are added to Servers. Relative paths are resolved against the
+	// directory of the file naming them.
+	Import []string `yaml:"import"`
+
+	// Sources are the files the configuration was read from, the file
+	// itself first.
+	Sources []string `yaml:"-"`
+}
+
+// Listener is an address the HTTP server listens on.
+type Listener struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+// Auth configures the API key required on requests.
+type Auth struct {
+	APIKey string `yaml:"apiKey"`
+}
+
+// Limits bound sessions and processes. Zero values keep the defaults.
+type Limits struct {
+	MaxSessions        int           `yaml:"maxSessions"`
+	SessionIdleTimeout time.Duration `yaml:"sessionIdleTimeout"`
+	SessionMaxLifetime time.Duration `yaml:"sessionMaxLifetime"`
+	TerminateTimeout   time.Duration `yaml:"terminateTimeout"`
+	ShutdownTimeout    time.Duration `yaml:"shutdownTimeout"`
+}
+
+// Server describes a stdio MCP server and how it is served.
+type Server struct {
+	// Type is "stdio" or empty. VS Code also lists remote servers, which
+	// are skipped on import.
+	Type      string            `yaml:"type"`
+	Command   string            `yaml:"command"`
+	Args      []string          `yaml:"args"`
+	Env       map[string]string `yaml:"env"`
+	Cwd       string            `yaml:"cwd"`
+	APIKey    string            `yaml:"apiKey"`
+	Stateless bool              `yaml:"stateless"`
+}
+
+// EnvList returns the server's environment as sorted KEY=VALUE entries.
+func (s Server) EnvList() []string {
+	keys := make([]string, 0, len(s.Env))
+	for key := range s.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, len(keys))
+	for i, key := range keys {
+		env[i] = key + "=" + s.Env[key]
+	}
+	return env
+}
+
+// Load reads the configuration file at path and the files it imports.
+func Load(path string) (*Config, error) {
+	cfg, err := parse(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	cfg.Sources = []string{path}
+
+	imported := map[string]Server{}
+	for _, ref := range cfg.Import {
+		importPath := resolvePath(dir, ref)
+		cfg.Sources = append(cfg.Sources, importPath)
+		other, err := parse(importPath)
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", ref, err)
+		}
+		for name, srv := range other.servers() {
+			imported[name] = srv
+		}
+	}
+
+	servers := imported
+	for name, srv := range cfg.servers() {
+		servers[name] = srv
+	}
+	for name, srv := range servers {
+		if srv.Type != "" && srv.Type != "stdio" {
+			log.Printf("[mcp-proxy] INFO: skipping server %s of type %s, only stdio servers can be proxied", name, srv.Type)
+			delete(servers, name)
+			continue
+		}
+		if ref := clientVariable(srv); ref != "" {
+			log.Printf("[mcp-proxy] INFO: skipping server %s, %s can only be resolved by VS Code", name, ref)
+			delete(servers, name)
+			continue
+		}
+		if srv.Command == "" {
+			return nil, fmt.Errorf("server %s has no command", name)
+		}
+		if strings.Contains(name, "/") {
+			return nil, fmt.Errorf("server name %q must not contain '/'", name)
+		}
+		if err := resolveSecrets(dir, &srv); err != nil {
+			return nil, fmt.Errorf("server %s: %w", name, err)
+		}
+		servers[name] = srv
+	}
+	cfg.Servers = servers
+	cfg.MCPServers = nil
+
+	if cfg.Server != nil {
+		if cfg.Server.Command == "" {
+			return nil, fmt.Errorf("server has no command")
+		}
+		if cfg.Server.APIKey != "" {
+			return nil, fmt.Errorf("server.apiKey is not supported, the top-level server uses auth.apiKey")
+		}
+		if ref := clientVariable(*cfg.Server); ref != "" {
+			return nil, fmt.Errorf("server: %s can only be resolved by VS Code", ref)
+		}
+		if err := resolveSecrets(dir, cfg.Server); err != nil {
+			return nil, fmt.Errorf("server: %w", err)
+		}
+	}
+	if cfg.Auth.APIKey, err = readSecret(dir, cfg.Auth.APIKey); err != nil {
+		return nil, fmt.Errorf("auth.apiKey: %w", err)
+	}
+	for _, l := range cfg.Listeners {
+		if l.Port <= 0 || l.Port > 65535 {
+			return nil, fmt.Errorf("listener %s:%d has an invalid port", l.Host, l.Port)
+		}
+	}
+
+	return cfg, nil
+}
+
+// servers merges the file's mcpServers and servers blocks.
+func (c *Config) servers() map[string]Server {
+	servers := map[string]Server{}
+	for name, srv := range c.MCPServers {
+		servers[name] = srv
+	}
+	for name, srv := range c.Servers {
+		servers[name] = srv
+	}
+	return servers
+}
+
+// parse decodes one file with environment references expanded.
+func parse(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		// JSON is valid YAML except for tab indentation, which editors
+		// commonly write, so JSON files are parsed as JSON.
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := root.Encode(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := expandNode(&root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg := &Config{}
+	if root.Kind == 0 {
+		// Empty file.
+		return cfg, nil
+	}
+	if err := root.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// resolvePath resolves a path relative to dir, expanding a leading ~/.
+func resolvePath(dir, path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
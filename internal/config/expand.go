@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretPrefix marks a value to be read from a file.
+const secretPrefix = "file:"
+
+// clientVariables are the VS Code variables without a colon that an mcp.json
+// may reference. Like ${input:id}, only the editor can resolve them.
+var clientVariables = map[string]bool{
+	"workspaceFolder":         true,
+	"workspaceFolderBasename": true,
+	"workspaceRoot":           true,
+	"userHome":                true,
+	"cwd":                     true,
+	"pathSeparator":           true,
+}
+
+// expandNode expands environment references in every scalar below node.
+func expandNode(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		expanded, err := expandEnv(node.Value)
+		if err != nil {
+			return err
+		}
+		if expanded != node.Value {
+			node.Value = expanded
+			if node.Style == 0 {
+				// Let an unquoted "${PORT}" decode as the number it
+				// expands to.
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := expandNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces ${NAME} with the value of the environment variable NAME
+// and ${NAME:-default} with default when NAME is unset or empty. An unset
+// variable without a default is an error, so that a missing secret is not
+// silently replaced by an empty string. VS Code's ${env:NAME} is read like
+// ${NAME}, and other VS Code variables such as ${input:id} are kept as they
+// are for Load to skip the servers that use them.
+func expandEnv(value string) (string, error) {
+	var out strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			out.WriteString(value)
+			return out.String(), nil
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in %q", value)
+		}
+		out.WriteString(value[:start])
+
+		ref := value[start+2 : start+end]
+		name, fallback, hasDefault := strings.Cut(ref, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty reference in %q", value)
+		}
+		if envName, ok := strings.CutPrefix(name, "env:"); ok {
+			name = envName
+		} else if isClientVariable(name) {
+			out.WriteString(value[start : start+end+1])
+			value = value[start+end+1:]
+			continue
+		}
+		resolved, ok := os.LookupEnv(name)
+		switch {
+		case hasDefault && resolved == "":
+			resolved = fallback
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		out.WriteString(resolved)
+		value = value[start+end+1:]
+	}
+}
+
+// isClientVariable reports whether a reference names a VS Code variable
+// rather than an environment variable.
+func isClientVariable(name string) bool {
+	if strings.HasPrefix(name, "env:") {
+		return false
+	}
+	return strings.Contains(name, ":") || clientVariables[name]
+}
+
+// clientVariable returns the first VS Code variable left in a server's
+// command line, environment or API key, or "" when there is none.
+func clientVariable(srv Server) string {
+	values := append([]string{srv.Command, srv.Cwd, srv.APIKey}, srv.Args...)
+	for _, value := range srv.Env {
+		values = append(values, value)
+	}
+	for _, value := range values {
+		for {
+			start := strings.Index(value, "${")
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(value[start:], '}')
+			if end < 0 {
+				break
+			}
+			if name, _, _ := strings.Cut(value[start+2:start+end], ":-"); isClientVariable(name) {
+				return value[start : start+end+1]
+			}
+			value = value[start+end+1:]
+		}
+	}
+	return ""
+}
+
+// resolveSecrets replaces file: references in a server's API key and env.
+func resolveSecrets(dir string, srv *Server) error {
+	var err error
+	if srv.APIKey, err = readSecret(dir, srv.APIKey); err != nil {
+		return fmt.Errorf("apiKey: %w", err)
+	}
+	if len(srv.Env) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(srv.Env))
+	for key, value := range srv.Env {
+		if env[key], err = readSecret(dir, value); err != nil {
+			return fmt.Errorf("env %s: %w", key, err)
+		}
+	}
+	srv.Env = env
+	return nil
+}
+
+// readSecret returns the content of the file a "file:<path>" value names,
+// without its trailing newline, and any other value unchanged.
+func readSecret(dir, value string) (string, error) {
+	path, ok := strings.CutPrefix(value, secretPrefix)
+	if !ok {
+		return value, nil
+	}
+	data, err := os.ReadFile(resolvePath(dir, path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
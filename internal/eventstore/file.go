@@ -0,0 +1,738 @@
+package eventstore
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSegmentBytes = 4 << 20
+	defaultSyncInterval = time.Second
+	defaultOrphanTTL    = 10 * time.Minute
+
+	segmentExt = ".log"
+	// recordHeader is the length, CRC, sequence number and timestamp that
+	// precede every payload in a segment.
+	recordHeader = 4 + 4 + 8 + 8
+)
+
+// SyncPolicy controls when File flushes segments to stable storage.
+type SyncPolicy string
+
+const (
+	// SyncAlways syncs after every event, so a stored event survives a
+	// machine crash.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval syncs written segments every FileOptions.SyncInterval,
+	// losing at most that much on a machine crash. A process crash loses
+	// nothing.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+// FileOptions configure a File store.
+type FileOptions struct {
+	// Dir holds one directory per stream.
+	Dir string
+	// SegmentBytes is the size at which a stream's log rolls over to a new
+	// segment. Defaults to 4 MiB.
+	SegmentBytes int64
+	// Sync defaults to SyncInterval.
+	Sync SyncPolicy
+	// SyncInterval defaults to 1s.
+	SyncInterval time.Duration
+
+	// MaxEventsPerStream, MaxBytes and TTL bound retention as in
+	// MemoryOptions. They are applied again when the store is opened.
+	MaxEventsPerStream int
+	MaxBytes           int64
+	TTL                time.Duration
+
+	// OrphanTTL is how long the streams found on open are kept. They belong
+	// to sessions of an earlier run and are only replayed to clients
+	// resuming them; streams written to again are kept. Defaults to 10
+	// minutes.
+	OrphanTTL time.Duration
+}
+
+// File is an event store that persists every stream as an append-only log of
+// segments, so that clients can resume streams after the proxy restarts.
+//
+// Each stream lives in a directory named after the hex-encoded stream ID and
+// each segment is named after the sequence number of its first event. Records
+// carry a CRC so that a torn write at the end of a segment is detected and
+// cut off when the store is opened. The index of every retained event is kept
+// in memory and rebuilt from the segments on open; payloads are read back
+// from disk on replay. Compaction deletes a segment once retention has
+// evicted all of its events. Streams found on open are deleted after
+// OrphanTTL unless they are written to again.
+type File struct {
+	opts FileOptions
+
+	mu        sync.Mutex
+	streams   map[string]*fileStream
+	dirty     map[*segment]struct{}
+	events    int
+	bytes     int64
+	evicted   uint64
+	lastSweep time.Time
+	closed    bool
+	orphans   map[string]struct{} // streams found on open and not written since
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// fileStream is the index of one stream's retained events.
+type fileStream struct {
+	dir      string
+	entries  []entry
+	segments []*segment // oldest first; the last one is appended to
+	next     uint64     // sequence number of the next event
+}
+
+type segment struct {
+	path string
+	file *os.File // open for the last segment of a stream only
+	size int64
+	live int // indexed events in the segment
+}
+
+type entry struct {
+	seq       uint64
+	seg       *segment
+	offset    int64 // of the payload
+	size      int
+	timestamp time.Time
+}
+
+var _ EventStore = (*File)(nil)
+
+// OpenFile opens or creates the store in opts.Dir and indexes the events
+// already on disk.
+func OpenFile(opts FileOptions) (*File, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("event store directory is required")
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	switch opts.Sync {
+	case "":
+		opts.Sync = SyncInterval
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q", opts.Sync)
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	if opts.OrphanTTL <= 0 {
+		opts.OrphanTTL = defaultOrphanTTL
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		opts:    opts,
+		streams: map[string]*fileStream{},
+		dirty:   map[*segment]struct{}{},
+		orphans: map[string]struct{}{},
+		done:    make(chan struct{}),
+	}
+	if err := f.load(); err != nil {
+		f.closeFiles()
+		return nil, err
+	}
+
+	if opts.Sync == SyncInterval {
+		f.wg.Add(1)
+		go f.syncLoop()
+	}
+	if len(f.orphans) > 0 {
+		f.wg.Add(1)
+		go f.dropOrphans()
+	}
+	return f, nil
+}
+
+// Store appends an event to the stream's log and returns its ID. It returns
+// "" when the event could not be written, in which case it is delivered but
+// cannot be replayed.
+func (f *File) Store(streamID string, payload []byte) string {
+	now := time.Now()
+
+	f.mu.Lock()
+	id, file := f.store(streamID, payload, now)
+	f.mu.Unlock()
+
+	// Syncing outside f.mu lets other streams append meanwhile. A segment
+	// closed in between was synced when it was closed.
+	if file != nil {
+		if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+			log.Printf("[mcp-proxy] ERROR: event store: sync %s: %v", file.Name(), err)
+		}
+	}
+	return id
+}
+
+// store appends the event and returns its ID, and the file to sync when
+// every event is synced. Callers hold f.mu.
+func (f *File) store(streamID string, payload []byte, now time.Time) (string, *os.File) {
+	if f.closed {
+		return "", nil
+	}
+	delete(f.orphans, streamID)
+
+	st, ok := f.streams[streamID]
+	if !ok {
+		st = &fileStream{dir: filepath.Join(f.opts.Dir, hex.EncodeToString([]byte(streamID))), next: 1}
+		f.streams[streamID] = st
+	}
+	seq := st.next
+
+	seg, err := f.activeSegment(st, seq)
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: event store: %v", err)
+		return "", nil
+	}
+	offset, err := appendRecord(seg, seq, now, payload)
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: event store: write %s: %v", seg.path, err)
+		return "", nil
+	}
+	var sync *os.File
+	switch f.opts.Sync {
+	case SyncAlways:
+		sync = seg.file
+	case SyncInterval:
+		f.dirty[seg] = struct{}{}
+	}
+
+	st.next++
+	st.entries = append(st.entries, entry{seq: seq, seg: seg, offset: offset, size: len(payload), timestamp: now})
+	seg.live++
+	f.events++
+	f.bytes += int64(len(payload))
+
+	f.enforce(st, now)
+	return FormatID(streamID, seq), sync
+}
+
+// ReplayAfter replays events for the same stream after the provided event ID.
+// An ID whose own event was evicted still replays when no later event is
+// missing.
+func (f *File) ReplayAfter(lastEventID string, fn func(Event)) string {
+	streamID, seq, ok := ParseID(lastEventID)
+	if !ok {
+		return ""
+	}
+
+	f.mu.Lock()
+	if f.opts.TTL > 0 {
+		f.expire(time.Now())
+	}
+	st, ok := f.streams[streamID]
+	if !ok || seq >= st.next || seq+1 < st.first() {
+		// Unknown, or events following it have been evicted.
+		f.mu.Unlock()
+		return ""
+	}
+	i := sort.Search(len(st.entries), func(i int) bool { return st.entries[i].seq > seq })
+	entries := slices.Clone(st.entries[i:])
+	files, err := openSegments(entries)
+	f.mu.Unlock()
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: event store: replay %s: %v", lastEventID, err)
+		return ""
+	}
+
+	// The payloads are read without f.mu. The files stay readable even if
+	// compaction deletes their segments meanwhile.
+	replay, err := read(streamID, entries, files)
+	for _, file := range files {
+		_ = file.Close()
+	}
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: event store: replay %s: %v", lastEventID, err)
+		return ""
+	}
+
+	for _, e := range replay {
+		fn(e)
+	}
+	return streamID
+}
+
+// DeleteStream removes the stream's log.
+func (f *File) DeleteStream(streamID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.orphans, streamID)
+	st, ok := f.streams[streamID]
+	if !ok {
+		return
+	}
+	for _, e := range st.entries {
+		f.bytes -= int64(e.size)
+	}
+	f.events -= len(st.entries)
+	for _, seg := range st.segments {
+		f.closeSegment(seg)
+	}
+	delete(f.streams, streamID)
+	if err := os.RemoveAll(st.dir); err != nil {
+		log.Printf("[mcp-proxy] ERROR: event store: %v", err)
+	}
+}
+
+// Stats returns a snapshot of the store's size.
+func (f *File) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	streams := 0
+	for _, st := range f.streams {
+		if len(st.entries) > 0 {
+			streams++
+		}
+	}
+	return Stats{
+		Streams: streams,
+		Events:  f.events,
+		Bytes:   f.bytes,
+		Evicted: f.evicted,
+	}
+}
+
+// Close syncs and closes every open segment. Streams stay on disk for the
+// next OpenFile.
+func (f *File) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.done)
+	f.mu.Unlock()
+
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closeFiles()
+}
+
+func (st *fileStream) first() uint64 {
+	if len(st.entries) == 0 {
+		return st.next
+	}
+	return st.entries[0].seq
+}
+
+// activeSegment returns the segment the event with sequence number seq is
+// appended to, rolling over to a new one when the current one is full.
+// Callers hold f.mu.
+func (f *File) activeSegment(st *fileStream, seq uint64) (*segment, error) {
+	if n := len(st.segments); n > 0 {
+		if seg := st.segments[n-1]; seg.size < f.opts.SegmentBytes && seg.file != nil {
+			return seg, nil
+		}
+		f.closeSegment(st.segments[n-1])
+		if st.segments[n-1].live == 0 {
+			f.removeSegment(st, n-1)
+		}
+	}
+
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(st.dir, segmentName(seq))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{path: path, file: file}
+	st.segments = append(st.segments, seg)
+	return seg, nil
+}
+
+// enforce applies the retention limits after an event was appended to st.
+// Callers hold f.mu.
+func (f *File) enforce(st *fileStream, now time.Time) {
+	if limit := f.opts.MaxEventsPerStream; limit > 0 {
+		if over := len(st.entries) - limit; over > 0 {
+			f.evict(st, over)
+		}
+	}
+	if f.opts.MaxBytes > 0 {
+		for f.bytes > f.opts.MaxBytes && f.evictOldest() {
+		}
+	}
+	if f.opts.TTL > 0 && now.Sub(f.lastSweep) >= sweepInterval {
+		f.expire(now)
+	}
+}
+
+// evict drops the n oldest events of a stream and deletes the segments left
+// without events. Callers hold f.mu.
+func (f *File) evict(st *fileStream, n int) {
+	for _, e := range st.entries[:n] {
+		e.seg.live--
+		f.bytes -= int64(e.size)
+	}
+	f.events -= n
+	f.evicted += uint64(n)
+	st.entries = st.entries[n:]
+
+	// The last segment is kept open for appending even when empty.
+	for len(st.segments) > 1 && st.segments[0].live == 0 {
+		f.removeSegment(st, 0)
+	}
+}
+
+// evictOldest drops the oldest event across all streams and reports whether
+// there was one. Callers hold f.mu.
+func (f *File) evictOldest() bool {
+	var oldest *fileStream
+	for _, st := range f.streams {
+		if len(st.entries) == 0 {
+			continue
+		}
+		if oldest == nil || st.entries[0].timestamp.Before(oldest.entries[0].timestamp) {
+			oldest = st
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	f.evict(oldest, 1)
+	return true
+}
+
+// expire drops the events older than the TTL. Callers hold f.mu.
+func (f *File) expire(now time.Time) {
+	f.lastSweep = now
+	cutoff := now.Add(-f.opts.TTL)
+	for _, st := range f.streams {
+		n := sort.Search(len(st.entries), func(i int) bool {
+			return !st.entries[i].timestamp.Before(cutoff)
+		})
+		if n > 0 {
+			f.evict(st, n)
+		}
+	}
+}
+
+// openSegments opens the segments holding entries for reading. Callers hold
+// f.mu, so that no segment is deleted before it is opened.
+func openSegments(entries []entry) (map[*segment]*os.File, error) {
+	files := map[*segment]*os.File{}
+	for _, e := range entries {
+		if files[e.seg] != nil {
+			continue
+		}
+		file, err := os.Open(e.seg.path)
+		if err != nil {
+			for _, opened := range files {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		files[e.seg] = file
+	}
+	return files, nil
+}
+
+// read loads the payloads of entries from the files of their segments.
+func read(streamID string, entries []entry, files map[*segment]*os.File) ([]Event, error) {
+	events := make([]Event, len(entries))
+	for i, e := range entries {
+		payload := make([]byte, e.size)
+		if _, err := files[e.seg].ReadAt(payload, e.offset); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.seg.path, err)
+		}
+		events[i] = Event{ID: FormatID(streamID, e.seq), StreamID: streamID, Payload: payload, Timestamp: e.timestamp}
+	}
+	return events, nil
+}
+
+// removeSegment closes and deletes the i-th segment of a stream. Callers
+// hold f.mu.
+func (f *File) removeSegment(st *fileStream, i int) {
+	seg := st.segments[i]
+	f.closeSegment(seg)
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[mcp-proxy] ERROR: event store: %v", err)
+	}
+	st.segments = append(st.segments[:i], st.segments[i+1:]...)
+}
+
+// closeSegment syncs and closes a segment's file if it is open. Callers hold
+// f.mu.
+func (f *File) closeSegment(seg *segment) {
+	if seg.file == nil {
+		return
+	}
+	if f.opts.Sync != SyncNever {
+		_ = seg.file.Sync()
+	}
+	_ = seg.file.Close()
+	seg.file = nil
+	delete(f.dirty, seg)
+}
+
+// closeFiles closes every open segment. Callers hold f.mu.
+func (f *File) closeFiles() error {
+	var errs []error
+	for _, st := range f.streams {
+		for _, seg := range st.segments {
+			if seg.file == nil {
+				continue
+			}
+			if f.opts.Sync != SyncNever {
+				errs = append(errs, seg.file.Sync())
+			}
+			errs = append(errs, seg.file.Close())
+			seg.file = nil
+		}
+	}
+	clear(f.dirty)
+	return errors.Join(errs...)
+}
+
+func (f *File) syncLoop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			files := make([]*os.File, 0, len(f.dirty))
+			for seg := range f.dirty {
+				files = append(files, seg.file)
+			}
+			clear(f.dirty)
+			f.mu.Unlock()
+
+			// A segment closed meanwhile was synced when it was closed.
+			for _, file := range files {
+				if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+					log.Printf("[mcp-proxy] ERROR: event store: sync %s: %v", file.Name(), err)
+				}
+			}
+		}
+	}
+}
+
+// dropOrphans deletes the streams found on open that were not written to
+// within OrphanTTL.
+func (f *File) dropOrphans() {
+	defer f.wg.Done()
+
+	timer := time.NewTimer(f.opts.OrphanTTL)
+	defer timer.Stop()
+
+	select {
+	case <-f.done:
+		return
+	case <-timer.C:
+	}
+
+	f.mu.Lock()
+	orphans := make([]string, 0, len(f.orphans))
+	for streamID := range f.orphans {
+		orphans = append(orphans, streamID)
+	}
+	clear(f.orphans)
+	f.mu.Unlock()
+
+	for _, streamID := range orphans {
+		f.DeleteStream(streamID)
+	}
+	if len(orphans) > 0 {
+		log.Printf("[mcp-proxy] INFO: event store: dropped %d stream(s) left by an earlier run", len(orphans))
+	}
+}
+
+// load indexes the streams found in the store's directory and applies the
+// retention limits to them. Streams left without events are removed.
+func (f *File) load() error {
+	dirs, err := os.ReadDir(f.opts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		name, err := hex.DecodeString(d.Name())
+		if !d.IsDir() || err != nil {
+			continue
+		}
+		st, err := loadStream(filepath.Join(f.opts.Dir, d.Name()))
+		if err != nil {
+			return err
+		}
+		f.streams[string(name)] = st
+		for _, e := range st.entries {
+			f.bytes += int64(e.size)
+		}
+		f.events += len(st.entries)
+	}
+
+	for _, st := range f.streams {
+		if limit := f.opts.MaxEventsPerStream; limit > 0 && len(st.entries) > limit {
+			f.evict(st, len(st.entries)-limit)
+		}
+	}
+	if f.opts.MaxBytes > 0 {
+		for f.bytes > f.opts.MaxBytes && f.evictOldest() {
+		}
+	}
+	if f.opts.TTL > 0 {
+		f.expire(time.Now())
+	}
+	f.evicted = 0
+
+	for streamID, st := range f.streams {
+		if len(st.entries) == 0 {
+			for _, seg := range st.segments {
+				f.closeSegment(seg)
+			}
+			delete(f.streams, streamID)
+			if err := os.RemoveAll(st.dir); err != nil {
+				return err
+			}
+			continue
+		}
+		f.orphans[streamID] = struct{}{}
+	}
+	return nil
+}
+
+// loadStream indexes the segments in dir and reopens the last one for
+// appending.
+func loadStream(dir string) (*fileStream, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), segmentExt) {
+			names = append(names, file.Name())
+		}
+	}
+	// Zero-padded names sort by first sequence number.
+	sort.Strings(names)
+
+	st := &fileStream{dir: dir, next: 1}
+	for _, name := range names {
+		seg := &segment{path: filepath.Join(dir, name)}
+		if first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64); err == nil && first > st.next {
+			st.next = first
+		}
+		if err := scanSegment(st, seg); err != nil {
+			return nil, err
+		}
+		if seg.live == 0 && seg.size == 0 {
+			_ = os.Remove(seg.path)
+			continue
+		}
+		st.segments = append(st.segments, seg)
+	}
+
+	if n := len(st.segments); n > 0 {
+		seg := st.segments[n-1]
+		if seg.file, err = os.OpenFile(seg.path, os.O_RDWR|os.O_APPEND, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// scanSegment indexes the records of a segment. A record that is cut short or
+// fails its CRC ends the segment, which is truncated there.
+func scanSegment(st *fileStream, seg *segment) error {
+	data, err := os.ReadFile(seg.path)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for int64(len(data))-offset >= recordHeader {
+		header := data[offset : offset+recordHeader]
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		sum := binary.BigEndian.Uint32(header[4:8])
+		seq := binary.BigEndian.Uint64(header[8:16])
+		end := offset + recordHeader + size
+		if end > int64(len(data)) || crc32.ChecksumIEEE(data[offset+8:end]) != sum || seq < st.next {
+			break
+		}
+		st.entries = append(st.entries, entry{
+			seq:       seq,
+			seg:       seg,
+			offset:    offset + recordHeader,
+			size:      int(size),
+			timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(header[16:24]))),
+		})
+		seg.live++
+		st.next = seq + 1
+		offset = end
+	}
+
+	if offset < int64(len(data)) {
+		log.Printf("[mcp-proxy] INFO: event store: truncating %s at byte %d after an incomplete record", seg.path, offset)
+		if err := os.Truncate(seg.path, offset); err != nil {
+			return err
+		}
+	}
+	seg.size = offset
+	return nil
+}
+
+// appendRecord writes one record to the segment and returns the offset of its
+// payload.
+func appendRecord(seg *segment, seq uint64, at time.Time, payload []byte) (int64, error) {
+	record := make([]byte, recordHeader+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(record[8:16], seq)
+	binary.BigEndian.PutUint64(record[16:24], uint64(at.UnixNano()))
+	copy(record[recordHeader:], payload)
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[8:]))
+
+	n, err := seg.file.Write(record)
+	if err != nil {
+		if n > 0 {
+			// Drop the partial record so the next one starts cleanly.
+			_ = seg.file.Truncate(seg.size)
+		}
+		return 0, err
+	}
+	offset := seg.size + recordHeader
+	seg.size += int64(n)
+	return offset, nil
+}
+
+func segmentName(firstSeq uint64) string {
+	return fmt.Sprintf("%020d%s", firstSeq, segmentExt)
+}
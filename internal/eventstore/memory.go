@@ -2,12 +2,15 @@ package eventstore
 
 import (
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
-
-	"github.com/google/uuid"
 )
 
+// sweepInterval bounds how often Store scans every stream for expired events.
+const sweepInterval = time.Second
+
 // Event holds the payload for a stored message.
 type Event struct {
 	ID        string
@@ -16,67 +19,225 @@ type Event struct {
 	Timestamp time.Time
 }
 
+// MemoryOptions bound what a Memory store retains. Zero values disable the
+// corresponding limit.
+type MemoryOptions struct {
+	// MaxEventsPerStream keeps only the newest events of each stream.
+	MaxEventsPerStream int
+	// MaxBytes caps the payload bytes of all streams together; the oldest
+	// events of any stream are evicted first.
+	MaxBytes int64
+	// TTL drops events older than this.
+	TTL time.Duration
+}
+
 // Memory implements an in-memory event store with resumability support.
+//
+// Event IDs have the form <stream>-<seq>, where seq counts up from 1 within
+// the stream, so events are ordered exactly and replay finds its starting
+// point with a binary search.
 type Memory struct {
-	mu     sync.RWMutex
-	events map[string]Event
+	opts MemoryOptions
+
+	mu        sync.Mutex
+	streams   map[string]*stream
+	events    int
+	bytes     int64
+	evicted   uint64
+	lastSweep time.Time
 }
 
-// NewMemory creates a new in-memory event store.
+// stream is the retained tail of one stream. Events are only ever appended
+// and evicted from the front, so their sequence numbers stay contiguous.
+type stream struct {
+	seqs   []uint64
+	events []Event
+	next   uint64 // sequence number of the next event
+}
+
+var _ EventStore = (*Memory)(nil)
+
+// NewMemory creates a new in-memory event store that retains every event
+// until its stream is deleted.
 func NewMemory() *Memory {
-	return &Memory{events: map[string]Event{}}
+	return NewMemoryWithOptions(MemoryOptions{})
+}
+
+// NewMemoryWithOptions creates an in-memory event store with bounded
+// retention.
+func NewMemoryWithOptions(opts MemoryOptions) *Memory {
+	return &Memory{
+		opts:    opts,
+		streams: map[string]*stream{},
+	}
 }
 
 // Store adds a new event to the store and returns the generated event ID.
 func (m *Memory) Store(streamID string, payload []byte) string {
+	dup := make([]byte, len(payload))
+	copy(dup, payload)
+	now := time.Now()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	eventID := m.generateID(streamID)
-	dup := make([]byte, len(payload))
-	copy(dup, payload)
-	m.events[eventID] = Event{ID: eventID, StreamID: streamID, Payload: dup, Timestamp: time.Now()}
-	return eventID
+	st, ok := m.streams[streamID]
+	if !ok {
+		st = &stream{next: 1}
+		m.streams[streamID] = st
+	}
+	seq := st.next
+	st.next++
+	event := Event{ID: FormatID(streamID, seq), StreamID: streamID, Payload: dup, Timestamp: now}
+	st.seqs = append(st.seqs, seq)
+	st.events = append(st.events, event)
+	m.events++
+	m.bytes += int64(len(dup))
+
+	if limit := m.opts.MaxEventsPerStream; limit > 0 {
+		if over := len(st.events) - limit; over > 0 {
+			m.evict(st, over)
+		}
+	}
+	if m.opts.MaxBytes > 0 {
+		for m.bytes > m.opts.MaxBytes && m.evictOldest() {
+		}
+	}
+	if m.opts.TTL > 0 && now.Sub(m.lastSweep) >= sweepInterval {
+		m.expire(now)
+	}
+
+	return event.ID
 }
 
 // ReplayAfter replays events for the same stream after the provided event ID.
+// An ID whose own event was evicted still replays when no later event is
+// missing.
 func (m *Memory) ReplayAfter(lastEventID string, fn func(Event)) string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	event, ok := m.events[lastEventID]
+	streamID, seq, ok := ParseID(lastEventID)
 	if !ok {
 		return ""
 	}
 
-	streamID := event.StreamID
+	m.mu.Lock()
+	if m.opts.TTL > 0 {
+		m.expire(time.Now())
+	}
+	st, ok := m.streams[streamID]
+	if !ok || seq >= st.next || seq+1 < st.next-uint64(len(st.events)) {
+		// Unknown, or events following it have been evicted.
+		m.mu.Unlock()
+		return ""
+	}
+	i := sort.Search(len(st.seqs), func(i int) bool { return st.seqs[i] > seq })
+	replay := make([]Event, len(st.events)-i)
+	copy(replay, st.events[i:])
+	m.mu.Unlock()
 
-	var streamEvents []Event
-	for _, e := range m.events {
-		if e.StreamID == streamID {
-			streamEvents = append(streamEvents, e)
+	for _, e := range replay {
+		fn(e)
+	}
+	return streamID
+}
+
+// DeleteStream drops every event of the stream.
+func (m *Memory) DeleteStream(streamID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.streams[streamID]
+	if !ok {
+		return
+	}
+	for _, e := range st.events {
+		m.bytes -= int64(len(e.Payload))
+	}
+	m.events -= len(st.events)
+	delete(m.streams, streamID)
+}
+
+// Stats returns a snapshot of the store's size.
+func (m *Memory) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	streams := 0
+	for _, st := range m.streams {
+		if len(st.events) > 0 {
+			streams++
 		}
 	}
+	return Stats{
+		Streams: streams,
+		Events:  m.events,
+		Bytes:   m.bytes,
+		Evicted: m.evicted,
+	}
+}
 
-	sort.Slice(streamEvents, func(i, j int) bool {
-		return streamEvents[i].Timestamp.Before(streamEvents[j].Timestamp)
-	})
+// evict drops the n oldest events of a stream. The stream itself is kept so
+// that its sequence keeps counting up. Callers hold m.mu.
+func (m *Memory) evict(st *stream, n int) {
+	for i := 0; i < n; i++ {
+		m.bytes -= int64(len(st.events[i].Payload))
+		// Release the payload; the slot itself goes when append next
+		// reallocates.
+		st.events[i] = Event{}
+	}
+	m.events -= n
+	m.evicted += uint64(n)
+	st.seqs = st.seqs[n:]
+	st.events = st.events[n:]
+}
 
-	found := false
-	for _, e := range streamEvents {
-		if e.ID == lastEventID {
-			found = true
+// evictOldest drops the oldest event across all streams and reports whether
+// there was one. Callers hold m.mu.
+func (m *Memory) evictOldest() bool {
+	var oldest *stream
+	for _, st := range m.streams {
+		if len(st.events) == 0 {
 			continue
 		}
+		if oldest == nil || st.events[0].Timestamp.Before(oldest.events[0].Timestamp) {
+			oldest = st
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	m.evict(oldest, 1)
+	return true
+}
 
-		if found {
-			fn(e)
+// expire drops the events older than the TTL. Callers hold m.mu.
+func (m *Memory) expire(now time.Time) {
+	m.lastSweep = now
+	cutoff := now.Add(-m.opts.TTL)
+	for _, st := range m.streams {
+		n := sort.Search(len(st.events), func(i int) bool {
+			return !st.events[i].Timestamp.Before(cutoff)
+		})
+		if n > 0 {
+			m.evict(st, n)
 		}
 	}
+}
 
-	return streamID
+// FormatID returns the ID of the event with sequence number seq on a stream.
+func FormatID(streamID string, seq uint64) string {
+	return streamID + "-" + strconv.FormatUint(seq, 10)
 }
 
-func (m *Memory) generateID(streamID string) string {
-	return streamID + "_" + uuid.NewString()
+// ParseID splits an event ID into its stream ID and sequence number. Stream
+// IDs may themselves contain dashes; the sequence follows the last one.
+func ParseID(eventID string) (string, uint64, bool) {
+	i := strings.LastIndexByte(eventID, '-')
+	if i <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(eventID[i+1:], 10, 64)
+	if err != nil || seq == 0 {
+		return "", 0, false
+	}
+	return eventID[:i], seq, true
 }
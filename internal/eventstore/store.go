@@ -0,0 +1,24 @@
+package eventstore
+
+// EventStore keeps the events sent on streams so that a client reconnecting
+// with Last-Event-ID can be sent what it missed.
+type EventStore interface {
+	// Store records payload on the stream and returns the new event's ID.
+	Store(streamID string, payload []byte) string
+	// ReplayAfter calls fn for the events of the stream lastEventID belongs
+	// to that were stored after it, in order, and returns the stream's ID.
+	// It returns "" when lastEventID is unknown or no longer retained.
+	ReplayAfter(lastEventID string, fn func(Event)) string
+	// DeleteStream drops every event of the stream.
+	DeleteStream(streamID string)
+	// Stats returns a snapshot of the store's size.
+	Stats() Stats
+}
+
+// Stats is a snapshot of an event store.
+type Stats struct {
+	Streams int    // streams with at least one event
+	Events  int    // retained events
+	Bytes   int64  // retained payload bytes
+	Evicted uint64 // events dropped by retention limits
+}
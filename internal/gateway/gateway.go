@@ -0,0 +1,603 @@
+// Package gateway presents several MCP servers as one. A Gateway is an
+// mcp.Transport that answers a client's requests itself: listings are merged
+// across backends with per-backend name prefixes, and calls are routed to the
+// backend that owns the tool, prompt or resource.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// JSON-RPC error codes returned by the gateway itself.
+const (
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+var errClosed = errors.New("gateway closed")
+
+// Backend is one MCP server aggregated by a Gateway.
+type Backend struct {
+	// Name identifies the backend in logs and pagination cursors and must be
+	// unique within a Gateway.
+	Name string
+	// Prefix is prepended to the backend's tool and prompt names. Resource
+	// URIs are passed through unchanged.
+	Prefix string
+	// Transport connects to the backend. The Gateway starts and closes it.
+	Transport mcp.Transport
+}
+
+type backend struct {
+	Backend
+	client *mcp.Client
+
+	mu           sync.Mutex
+	ready        bool // initialized successfully
+	gone         bool // transport closed
+	capabilities map[string]json.RawMessage
+}
+
+// live reports whether the backend is initialized and still running.
+func (b *backend) live() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ready && !b.gone
+}
+
+func (b *backend) has(capability string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.capabilities[capability]
+	return b.ready && !b.gone && ok
+}
+
+// route is where an exposed tool or prompt name leads.
+type route struct {
+	backend *backend
+	name    string
+}
+
+// serverRequest is a request from a backend forwarded to the client under a
+// gateway-assigned ID.
+type serverRequest struct {
+	backend *backend
+	id      json.RawMessage
+}
+
+// Gateway aggregates its backends into a single MCP server.
+type Gateway struct {
+	backends []*backend
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	seq      atomic.Uint64
+
+	mu        sync.Mutex
+	tools     map[string]route
+	prompts   map[string]route
+	resources map[string]*backend                // URI -> owner, learned from listings
+	inflight  map[string]context.CancelCauseFunc // client request ID -> cancel
+	requests  map[string]serverRequest           // gateway ID -> backend request
+	closed    bool
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+}
+
+// New creates a gateway over the given backends.
+func New(backends ...Backend) *Gateway {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Gateway{
+		ctx:       ctx,
+		cancel:    cancel,
+		tools:     map[string]route{},
+		prompts:   map[string]route{},
+		resources: map[string]*backend{},
+		inflight:  map[string]context.CancelCauseFunc{},
+		requests:  map[string]serverRequest{},
+	}
+	for _, cfg := range backends {
+		b := &backend{Backend: cfg, client: mcp.NewClient(cfg.Transport)}
+		b.client.OnRequest(func(msg mcp.Message) { g.fromBackend(b, msg) })
+		b.client.OnClose(func() { g.backendClosed(b) })
+		g.backends = append(g.backends, b)
+	}
+	return g
+}
+
+// OnMessage registers a callback for messages to the client.
+func (g *Gateway) OnMessage(fn func(mcp.Message)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onMessage = fn
+}
+
+// OnError registers a callback for errors.
+func (g *Gateway) OnError(fn func(error)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onError = fn
+}
+
+// OnClose registers a callback invoked when the gateway closes, either
+// explicitly or because every backend went away.
+func (g *Gateway) OnClose(fn func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onClose = fn
+}
+
+// Start starts every backend transport. If one fails, the ones already
+// started are closed again.
+func (g *Gateway) Start(ctx context.Context) error {
+	for i, b := range g.backends {
+		if err := b.client.Start(ctx); err != nil {
+			for _, started := range g.backends[:i] {
+				_ = started.client.Close()
+			}
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+	}
+	return nil
+}
+
+// Send handles a message from the client. Requests are answered
+// asynchronously through the OnMessage callback.
+func (g *Gateway) Send(ctx context.Context, msg mcp.Message) error {
+	g.mu.Lock()
+	closed := g.closed
+	g.mu.Unlock()
+	if closed {
+		return errClosed
+	}
+
+	msgs, _, err := mcp.SplitBatch(msg.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for _, raw := range msgs {
+		var envelope struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return err
+		}
+
+		switch {
+		case envelope.Method == "" && len(envelope.ID) > 0:
+			g.answerBackend(envelope.ID, raw)
+		case envelope.Method == "":
+			return errors.New("message is neither a request, a notification nor a response")
+		case len(envelope.ID) == 0:
+			g.notify(envelope.Method, envelope.Params)
+		default:
+			g.mu.Lock()
+			if g.closed {
+				g.mu.Unlock()
+				return errClosed
+			}
+			g.wg.Add(1)
+			g.mu.Unlock()
+			go g.handleRequest(envelope.ID, envelope.Method, envelope.Params)
+		}
+	}
+	return nil
+}
+
+// Close closes every backend.
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	onClose := g.onClose
+	g.mu.Unlock()
+
+	g.cancel()
+	var errs []error
+	for _, b := range g.backends {
+		if err := b.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("backend %s: %w", b.Name, err))
+		}
+	}
+	g.wg.Wait()
+
+	if onClose != nil {
+		onClose()
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Gateway) handleRequest(id json.RawMessage, method string, params json.RawMessage) {
+	defer g.wg.Done()
+
+	ctx, cancel := context.WithCancelCause(g.ctx)
+	defer cancel(nil)
+
+	key := string(id)
+	g.mu.Lock()
+	g.inflight[key] = cancel
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.inflight, key)
+		g.mu.Unlock()
+	}()
+
+	result, rpcErr := g.dispatch(ctx, method, params)
+	if ctx.Err() != nil {
+		// Cancelled by the client or closed; no response is expected.
+		return
+	}
+
+	response := map[string]any{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	g.emit(response)
+}
+
+func (g *Gateway) dispatch(ctx context.Context, method string, params json.RawMessage) (any, *mcp.ResponseError) {
+	switch method {
+	case "initialize":
+		return g.initialize(ctx, params)
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return g.list(ctx, method, params, "tools", "tools", g.exposeNamed(g.tools))
+	case "prompts/list":
+		return g.list(ctx, method, params, "prompts", "prompts", g.exposeNamed(g.prompts))
+	case "resources/list":
+		return g.list(ctx, method, params, "resources", "resources", g.exposeResource)
+	case "resources/templates/list":
+		return g.list(ctx, method, params, "resources", "resourceTemplates", nil)
+	case "tools/call":
+		return g.callNamed(ctx, method, params, g.tools, "tools", "tool")
+	case "prompts/get":
+		return g.callNamed(ctx, method, params, g.prompts, "prompts", "prompt")
+	case "resources/read", "resources/subscribe", "resources/unsubscribe":
+		return g.callResource(ctx, method, params)
+	case "completion/complete":
+		return g.complete(ctx, params)
+	case "logging/setLevel":
+		return g.setLevel(ctx, params)
+	default:
+		return nil, &mcp.ResponseError{Code: codeMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// call forwards a request to one backend and returns its result or error.
+func (g *Gateway) call(ctx context.Context, b *backend, method string, params any) (json.RawMessage, *mcp.ResponseError) {
+	msg, err := b.client.Call(ctx, method, params)
+	if err != nil {
+		return nil, &mcp.ResponseError{Code: codeInternalError, Message: fmt.Sprintf("backend %s: %v", b.Name, err)}
+	}
+
+	var resp mcp.Response
+	if err := json.Unmarshal(msg.Bytes(), &resp); err != nil {
+		return nil, &mcp.ResponseError{Code: codeInternalError, Message: fmt.Sprintf("backend %s: %v", b.Name, err)}
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	if len(resp.Result) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	return resp.Result, nil
+}
+
+// callNamed routes tools/call or prompts/get by the exposed name, stripping
+// the backend's prefix.
+func (g *Gateway) callNamed(ctx context.Context, method string, params json.RawMessage, routes map[string]route, capability, kind string) (any, *mcp.ResponseError) {
+	fields, err := decodeParams(params)
+	if err != nil {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	var name string
+	if err := json.Unmarshal(fields["name"], &name); err != nil || name == "" {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "missing " + kind + " name"}
+	}
+
+	g.mu.Lock()
+	target, ok := routes[name]
+	g.mu.Unlock()
+	if !ok {
+		// The client may call without listing first; fall back to the
+		// longest matching prefix.
+		target, ok = g.routeByPrefix(name, capability)
+	}
+	if !ok {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown %s: %s", kind, name)}
+	}
+
+	fields["name"], _ = json.Marshal(target.name)
+	return g.call(ctx, target.backend, method, fields)
+}
+
+func (g *Gateway) routeByPrefix(name, capability string) (route, bool) {
+	var best *backend
+	for _, b := range g.backends {
+		if !b.has(capability) || !strings.HasPrefix(name, b.Prefix) {
+			continue
+		}
+		if best == nil || len(b.Prefix) > len(best.Prefix) {
+			best = b
+		}
+	}
+	if best == nil {
+		return route{}, false
+	}
+	return route{backend: best, name: strings.TrimPrefix(name, best.Prefix)}, true
+}
+
+// callResource routes a resource request by URI. URIs not seen in a listing,
+// such as ones built from templates, are tried on every backend in turn.
+func (g *Gateway) callResource(ctx context.Context, method string, params json.RawMessage) (any, *mcp.ResponseError) {
+	fields, err := decodeParams(params)
+	if err != nil {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	var uri string
+	if err := json.Unmarshal(fields["uri"], &uri); err != nil || uri == "" {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "missing resource uri"}
+	}
+
+	g.mu.Lock()
+	owner, ok := g.resources[uri]
+	g.mu.Unlock()
+	if ok {
+		return g.call(ctx, owner, method, fields)
+	}
+
+	rpcErr := &mcp.ResponseError{Code: codeInvalidParams, Message: "unknown resource: " + uri}
+	for _, b := range g.backends {
+		if !b.has("resources") {
+			continue
+		}
+		result, callErr := g.call(ctx, b, method, fields)
+		if callErr == nil {
+			g.mu.Lock()
+			g.resources[uri] = b
+			g.mu.Unlock()
+			return result, nil
+		}
+		rpcErr = callErr
+	}
+	return nil, rpcErr
+}
+
+// complete routes completion/complete by the prompt or resource it refers to.
+func (g *Gateway) complete(ctx context.Context, params json.RawMessage) (any, *mcp.ResponseError) {
+	fields, err := decodeParams(params)
+	if err != nil {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	ref, err := decodeParams(fields["ref"])
+	if err != nil {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "invalid ref"}
+	}
+
+	var refType string
+	_ = json.Unmarshal(ref["type"], &refType)
+	switch refType {
+	case "ref/prompt":
+		var name string
+		_ = json.Unmarshal(ref["name"], &name)
+		g.mu.Lock()
+		target, ok := g.prompts[name]
+		g.mu.Unlock()
+		if !ok {
+			target, ok = g.routeByPrefix(name, "prompts")
+		}
+		if !ok {
+			return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "unknown prompt: " + name}
+		}
+		ref["name"], _ = json.Marshal(target.name)
+		fields["ref"], _ = json.Marshal(ref)
+		return g.call(ctx, target.backend, "completion/complete", fields)
+	case "ref/resource":
+		var uri string
+		_ = json.Unmarshal(ref["uri"], &uri)
+		g.mu.Lock()
+		owner, ok := g.resources[uri]
+		g.mu.Unlock()
+		if !ok {
+			return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "unknown resource: " + uri}
+		}
+		return g.call(ctx, owner, "completion/complete", fields)
+	default:
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "unsupported ref type: " + refType}
+	}
+}
+
+// setLevel forwards logging/setLevel to every backend that supports logging.
+func (g *Gateway) setLevel(ctx context.Context, params json.RawMessage) (any, *mcp.ResponseError) {
+	for _, b := range g.backends {
+		if !b.has("logging") {
+			continue
+		}
+		if _, rpcErr := g.call(ctx, b, "logging/setLevel", params); rpcErr != nil {
+			return nil, rpcErr
+		}
+	}
+	return struct{}{}, nil
+}
+
+// notify handles a notification from the client. A cancellation stops the
+// request it names; the backend calls it made are cancelled in turn under
+// the backends' own request IDs, with the client's reason.
+func (g *Gateway) notify(method string, params json.RawMessage) {
+	if method == "notifications/cancelled" {
+		var cancelled struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		if json.Unmarshal(params, &cancelled) == nil {
+			g.mu.Lock()
+			cancel, ok := g.inflight[string(cancelled.RequestID)]
+			g.mu.Unlock()
+			if ok {
+				if cancelled.Reason == "" {
+					cancelled.Reason = "cancelled by the client"
+				}
+				cancel(errors.New(cancelled.Reason))
+			}
+		}
+		return
+	}
+
+	for _, b := range g.backends {
+		if !b.live() {
+			continue
+		}
+		var p any
+		if len(params) > 0 {
+			p = params
+		}
+		if err := b.client.Notify(g.ctx, method, p); err != nil {
+			log.Printf("[mcp-proxy] DEBUG: gateway failed to forward %s to backend %s: %v", method, b.Name, err)
+		}
+	}
+}
+
+// fromBackend forwards a backend's notification or request to the client.
+// Requests get a gateway ID so the client's answer can be routed back.
+func (g *Gateway) fromBackend(b *backend, msg mcp.Message) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Bytes(), &fields); err != nil {
+		return
+	}
+
+	if id, ok := fields["id"]; ok {
+		gatewayID := fmt.Sprintf("gateway-%d", g.seq.Add(1))
+		g.mu.Lock()
+		g.requests[gatewayID] = serverRequest{backend: b, id: id}
+		g.mu.Unlock()
+		fields["id"], _ = json.Marshal(gatewayID)
+	}
+	g.emit(fields)
+}
+
+// answerBackend routes the client's answer to a forwarded backend request.
+func (g *Gateway) answerBackend(id json.RawMessage, raw json.RawMessage) {
+	var gatewayID string
+	_ = json.Unmarshal(id, &gatewayID)
+
+	g.mu.Lock()
+	req, ok := g.requests[gatewayID]
+	delete(g.requests, gatewayID)
+	g.mu.Unlock()
+	if !ok {
+		log.Printf("[mcp-proxy] DEBUG: gateway dropping response %s that matches no backend request", id)
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return
+	}
+	fields["id"] = req.id
+	payload, _ := json.Marshal(fields)
+	if err := req.backend.Transport.Send(g.ctx, mcp.NewMessage(payload)); err != nil {
+		log.Printf("[mcp-proxy] DEBUG: gateway failed to answer backend %s: %v", req.backend.Name, err)
+	}
+}
+
+// backendClosed drops a backend that went away and tells the client its
+// lists changed. The gateway closes once no backend is left.
+func (g *Gateway) backendClosed(b *backend) {
+	b.mu.Lock()
+	b.gone = true
+	b.mu.Unlock()
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return
+	}
+	for _, key := range []string{"tools", "prompts", "resources"} {
+		g.forget(b, key)
+	}
+	g.mu.Unlock()
+
+	log.Printf("[mcp-proxy] INFO: gateway backend %s closed", b.Name)
+
+	for _, other := range g.backends {
+		other.mu.Lock()
+		gone := other.gone
+		other.mu.Unlock()
+		if !gone {
+			for _, kind := range []string{"tools", "prompts", "resources"} {
+				g.emit(map[string]any{"jsonrpc": "2.0", "method": "notifications/" + kind + "/list_changed"})
+			}
+			return
+		}
+	}
+	go g.Close()
+}
+
+// forget drops the routes of a backend learned from the listing of key
+// (tools, prompts or resources). g.mu must be held.
+func (g *Gateway) forget(b *backend, key string) {
+	var routes map[string]route
+	switch key {
+	case "tools":
+		routes = g.tools
+	case "prompts":
+		routes = g.prompts
+	case "resources":
+		for uri, owner := range g.resources {
+			if owner == b {
+				delete(g.resources, uri)
+			}
+		}
+		return
+	}
+	for name, r := range routes {
+		if r.backend == b {
+			delete(routes, name)
+		}
+	}
+}
+
+func (g *Gateway) emit(payload any) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	onMessage := g.onMessage
+	g.mu.Unlock()
+	if onMessage != nil {
+		onMessage(mcp.NewMessage(raw))
+	}
+}
+
+func decodeParams(params json.RawMessage) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if len(params) == 0 || string(params) == "null" {
+		return fields, nil
+	}
+	if err := json.Unmarshal(params, &fields); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	return fields, nil
+}
@@ -0,0 +1,282 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// serverName is reported as serverInfo.name in the merged initialize result.
+const serverName = "mcp-proxy-gateway"
+
+// initialize runs the client's initialize request against every backend and
+// merges their capabilities. Backends that fail are left out of the session;
+// the request only fails when none succeeds.
+func (g *Gateway) initialize(ctx context.Context, params json.RawMessage) (any, *mcp.ResponseError) {
+	type initResult struct {
+		ProtocolVersion string                     `json:"protocolVersion"`
+		Capabilities    map[string]json.RawMessage `json:"capabilities"`
+		Instructions    string                     `json:"instructions"`
+	}
+
+	results := make([]*initResult, len(g.backends))
+	var wg sync.WaitGroup
+	for i, b := range g.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			raw, rpcErr := g.call(ctx, b, "initialize", json.RawMessage(params))
+			if rpcErr != nil {
+				log.Printf("[mcp-proxy] ERROR: gateway backend %s failed to initialize: %s", b.Name, rpcErr.Message)
+				return
+			}
+			var result initResult
+			if err := json.Unmarshal(raw, &result); err != nil {
+				log.Printf("[mcp-proxy] ERROR: gateway backend %s returned an invalid initialize result: %v", b.Name, err)
+				return
+			}
+			if result.Capabilities == nil {
+				result.Capabilities = map[string]json.RawMessage{}
+			}
+			results[i] = &result
+		}()
+	}
+	wg.Wait()
+
+	merged := map[string]map[string]any{}
+	var protocolVersion string
+	var instructions []string
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		b := g.backends[i]
+		b.mu.Lock()
+		b.ready = true
+		b.capabilities = result.Capabilities
+		b.mu.Unlock()
+
+		if protocolVersion == "" {
+			protocolVersion = result.ProtocolVersion
+		}
+		if result.Instructions != "" {
+			instructions = append(instructions, fmt.Sprintf("%s: %s", b.Name, result.Instructions))
+		}
+		mergeCapabilities(merged, result.Capabilities)
+	}
+
+	if protocolVersion == "" {
+		return nil, &mcp.ResponseError{Code: codeInternalError, Message: "no backend could be initialized"}
+	}
+
+	response := map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    merged,
+		"serverInfo":      map[string]any{"name": serverName, "version": "1.0.0"},
+	}
+	if len(instructions) > 0 {
+		response["instructions"] = strings.Join(instructions, "\n\n")
+	}
+	return response, nil
+}
+
+// mergeCapabilities adds a backend's capabilities to merged. Flags such as
+// listChanged or subscribe are set if any backend sets them; other fields
+// keep the first value seen.
+func mergeCapabilities(merged map[string]map[string]any, caps map[string]json.RawMessage) {
+	for name, raw := range caps {
+		target, ok := merged[name]
+		if !ok {
+			target = map[string]any{}
+			merged[name] = target
+		}
+
+		var fields map[string]any
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			continue
+		}
+		for key, value := range fields {
+			if flag, isBool := value.(bool); isBool {
+				existing, _ := target[key].(bool)
+				target[key] = existing || flag
+				continue
+			}
+			if _, seen := target[key]; !seen {
+				target[key] = value
+			}
+		}
+	}
+}
+
+// exposer rewrites one listed item of a backend for the client and records
+// where it leads. It returns false to leave the item out.
+type exposer func(b *backend, item map[string]json.RawMessage) bool
+
+// exposeNamed prefixes tool or prompt names and records their routes.
+func (g *Gateway) exposeNamed(routes map[string]route) exposer {
+	return func(b *backend, item map[string]json.RawMessage) bool {
+		var name string
+		if err := json.Unmarshal(item["name"], &name); err != nil {
+			return false
+		}
+		exposed := b.Prefix + name
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if existing, ok := routes[exposed]; ok && existing.backend != b {
+			log.Printf("[mcp-proxy] DEBUG: gateway hides %s from backend %s, already provided by %s", exposed, b.Name, existing.backend.Name)
+			return false
+		}
+		routes[exposed] = route{backend: b, name: name}
+		item["name"], _ = json.Marshal(exposed)
+		return true
+	}
+}
+
+// exposeResource records which backend owns a listed resource URI.
+func (g *Gateway) exposeResource(b *backend, item map[string]json.RawMessage) bool {
+	var uri string
+	if err := json.Unmarshal(item["uri"], &uri); err != nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if owner, ok := g.resources[uri]; ok && owner != b {
+		log.Printf("[mcp-proxy] DEBUG: gateway hides %s from backend %s, already provided by %s", uri, b.Name, owner.Name)
+		return false
+	}
+	g.resources[uri] = b
+	return true
+}
+
+// list merges one page of a list method across backends. The combined cursor
+// holds each backend's own cursor, so every call fetches the next page of
+// every backend that has more, and a first call returns every backend's first
+// page. A backend's first page replaces the routes learned from its earlier
+// listings, so removed tools, prompts and resources stop being routed.
+func (g *Gateway) list(ctx context.Context, method string, params json.RawMessage, capability, key string, expose exposer) (any, *mcp.ResponseError) {
+	fields, err := decodeParams(params)
+	if err != nil {
+		return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	var cursors map[string]string
+	if raw, ok := fields["cursor"]; ok {
+		var cursor string
+		if err := json.Unmarshal(raw, &cursor); err != nil {
+			return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "invalid cursor"}
+		}
+		if cursors, err = decodeCursor(cursor); err != nil {
+			return nil, &mcp.ResponseError{Code: codeInvalidParams, Message: "invalid cursor"}
+		}
+	}
+
+	type page struct {
+		items []map[string]json.RawMessage
+		next  string
+	}
+	pages := make([]*page, len(g.backends))
+
+	var wg sync.WaitGroup
+	for i, b := range g.backends {
+		if !b.has(capability) {
+			continue
+		}
+		request := map[string]json.RawMessage{}
+		for k, v := range fields {
+			request[k] = v
+		}
+		delete(request, "cursor")
+		if cursors != nil {
+			cursor, more := cursors[b.Name]
+			if !more {
+				continue
+			}
+			request["cursor"], _ = json.Marshal(cursor)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			raw, rpcErr := g.call(ctx, b, method, request)
+			if rpcErr != nil {
+				// One failing backend should not hide the others' items.
+				log.Printf("[mcp-proxy] DEBUG: gateway backend %s failed %s: %s", b.Name, method, rpcErr.Message)
+				return
+			}
+			var result map[string]json.RawMessage
+			var p page
+			err := json.Unmarshal(raw, &result)
+			if err == nil && len(result[key]) > 0 {
+				err = json.Unmarshal(result[key], &p.items)
+			}
+			if err == nil && len(result["nextCursor"]) > 0 {
+				err = json.Unmarshal(result["nextCursor"], &p.next)
+			}
+			if err != nil {
+				log.Printf("[mcp-proxy] DEBUG: gateway backend %s returned an invalid %s result: %v", b.Name, method, err)
+				return
+			}
+			pages[i] = &p
+		}()
+	}
+	wg.Wait()
+
+	if expose != nil && cursors == nil {
+		g.mu.Lock()
+		for i, p := range pages {
+			if p != nil {
+				g.forget(g.backends[i], key)
+			}
+		}
+		g.mu.Unlock()
+	}
+
+	merged := []map[string]json.RawMessage{}
+	next := map[string]string{}
+	for i, p := range pages {
+		if p == nil {
+			continue
+		}
+		b := g.backends[i]
+		for _, item := range p.items {
+			if expose == nil || expose(b, item) {
+				merged = append(merged, item)
+			}
+		}
+		if p.next != "" {
+			next[b.Name] = p.next
+		}
+	}
+
+	result := map[string]any{key: merged}
+	if len(next) > 0 {
+		result["nextCursor"] = encodeCursor(next)
+	}
+	return result, nil
+}
+
+// encodeCursor packs the per-backend cursors into one opaque cursor.
+func encodeCursor(cursors map[string]string) string {
+	raw, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (map[string]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var cursors map[string]string
+	if err := json.Unmarshal(raw, &cursors); err != nil {
+		return nil, err
+	}
+	return cursors, nil
+}
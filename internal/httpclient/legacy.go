@@ -0,0 +1,206 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// SSETransport talks to a server using the legacy HTTP+SSE transport
+// (protocol version 2024-11-05): a long-lived GET stream announces the
+// message endpoint in an "endpoint" event and then carries every server
+// message, while client messages are POSTed to that endpoint.
+type SSETransport struct {
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	endpoint  string
+	ready     chan struct{}
+	closed    bool
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+}
+
+// NewSSE creates a legacy HTTP+SSE client transport for the stream at
+// opts.URL. Retry settings are ignored.
+func NewSSE(opts Options) *SSETransport {
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SSETransport{opts: opts, ctx: ctx, cancel: cancel, ready: make(chan struct{})}
+}
+
+// OnMessage registers a callback for inbound messages.
+func (t *SSETransport) OnMessage(fn func(mcp.Message)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onMessage = fn
+}
+
+// OnError registers a callback for transport errors.
+func (t *SSETransport) OnError(fn func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onError = fn
+}
+
+// OnClose registers a callback invoked when the stream ends or the
+// transport is closed.
+func (t *SSETransport) OnClose(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onClose = fn
+}
+
+// Start opens the event stream and waits for the server to announce its
+// message endpoint.
+func (t *SSETransport) Start(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodGet, t.opts.URL, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range t.opts.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := t.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		return fmt.Errorf("SSE stream returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		t.read(resp)
+	}()
+
+	select {
+	case <-t.ready:
+		return nil
+	case <-streamDone:
+		return errors.New("SSE stream ended before the endpoint event")
+	case <-ctx.Done():
+		_ = t.Close()
+		return ctx.Err()
+	}
+}
+
+func (t *SSETransport) read(resp *http.Response) {
+	defer t.Close()
+	defer resp.Body.Close()
+
+	err := readEvents(resp.Body, func(ev event) {
+		switch ev.Event {
+		case "endpoint":
+			t.setEndpoint(ev.Data)
+		case "", "message":
+			t.mu.Lock()
+			onMessage := t.onMessage
+			t.mu.Unlock()
+			if onMessage != nil {
+				onMessage(mcp.NewMessage([]byte(ev.Data)))
+			}
+		}
+	})
+	if err != nil {
+		t.mu.Lock()
+		closed, onError := t.closed, t.onError
+		t.mu.Unlock()
+		if !closed && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (t *SSETransport) setEndpoint(ref string) {
+	base, err := url.Parse(t.opts.URL)
+	if err != nil {
+		return
+	}
+	endpoint, err := base.Parse(ref)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.endpoint == "" {
+		t.endpoint = endpoint.String()
+		close(t.ready)
+	}
+}
+
+// Send POSTs the message to the announced endpoint. Replies arrive on the
+// event stream.
+func (t *SSETransport) Send(ctx context.Context, msg mcp.Message) error {
+	t.mu.Lock()
+	endpoint, closed := t.endpoint, t.closed
+	t.mu.Unlock()
+	if closed {
+		return errClosed
+	}
+	if endpoint == "" {
+		return errors.New("SSE transport not started")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(msg.Bytes()))
+	if err != nil {
+		return err
+	}
+	for name, values := range t.opts.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("POST %s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close ends the event stream.
+func (t *SSETransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	onClose := t.onClose
+	t.mu.Unlock()
+
+	t.cancel()
+	if onClose != nil {
+		onClose()
+	}
+	return nil
+}
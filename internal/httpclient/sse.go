@@ -0,0 +1,58 @@
+package httpclient
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// event is one server-sent event.
+type event struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readEvents parses a text/event-stream body and calls fn for every complete
+// event until the stream ends.
+func readEvents(r io.Reader, fn func(event)) error {
+	reader := bufio.NewReader(r)
+	var current event
+	var data []string
+
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 || err == nil {
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case line == "":
+				if len(data) > 0 {
+					current.Data = strings.Join(data, "\n")
+					fn(current)
+				}
+				current = event{}
+				data = nil
+			case strings.HasPrefix(line, ":"):
+				// Comment, used for keepalives.
+			default:
+				field, value, _ := strings.Cut(line, ":")
+				value = strings.TrimPrefix(value, " ")
+				switch field {
+				case "id":
+					current.ID = value
+				case "event":
+					current.Event = value
+				case "data":
+					data = append(data, value)
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
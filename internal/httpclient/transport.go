@@ -0,0 +1,687 @@
+// Package httpclient implements mcp.Transports that talk to a remote MCP
+// server over the streamable HTTP transport or the legacy HTTP+SSE one.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+const (
+	sessionHeader  = "mcp-session-id"
+	versionHeader  = "mcp-protocol-version"
+	maxErrorBody   = 4 << 10
+	defaultRetries = 3
+
+	// maxStreamBackoff caps the delay between GET stream reconnects.
+	maxStreamBackoff = 30 * time.Second
+	// deleteTimeout bounds the DELETE sent by Close.
+	deleteTimeout = 5 * time.Second
+)
+
+var errClosed = errors.New("http transport closed")
+
+// Options configures a Transport.
+type Options struct {
+	// URL of the remote streamable HTTP endpoint, e.g. https://host/mcp.
+	URL string
+	// Headers are added to every request, typically Authorization or
+	// X-API-Key.
+	Headers http.Header
+	// Client performs the requests. Defaults to a client without timeout,
+	// since responses may stream for as long as a tool runs.
+	Client *http.Client
+	// MaxRetries is how often a request is retried after a connection error
+	// or a 429/502/503/504 response. Requests that are not idempotent, such
+	// as tools/call, are only retried when the server cannot have seen them:
+	// after a failed dial or a 429/503 response. Defaults to 3.
+	MaxRetries int
+	// RetryBackoff is the initial delay between retries; it doubles per
+	// attempt unless the server sends Retry-After. Defaults to 500ms.
+	RetryBackoff time.Duration
+}
+
+// Transport sends each outgoing message as a POST and delivers the JSON or
+// SSE response bodies as inbound messages. Once a session is established a
+// GET stream carries server-initiated messages and is resumed with
+// Last-Event-ID after a disconnect. When the remote session expires the
+// cached initialize handshake is replayed under a new session, and Close
+// ends the session with DELETE.
+type Transport struct {
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	seq    atomic.Uint64
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+	initRequest     []byte
+	initID          string
+	initialized     []byte
+	pending         map[string]struct{} // request ids awaiting a response
+	streamEventID   string              // last event id seen on the GET stream of this session
+	listenFor       string              // session the GET stream is open for
+	noStream        bool                // server answered 405 to GET
+	closed          bool
+	reinitMu        sync.Mutex
+
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+}
+
+// New creates an HTTP client transport.
+func New(opts Options) *Transport {
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Transport{opts: opts, ctx: ctx, cancel: cancel, pending: map[string]struct{}{}}
+}
+
+// OnMessage registers a callback for inbound messages.
+func (t *Transport) OnMessage(fn func(mcp.Message)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onMessage = fn
+}
+
+// OnError registers a callback for transport errors.
+func (t *Transport) OnError(fn func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onError = fn
+}
+
+// OnClose registers a callback invoked when the transport closes.
+func (t *Transport) OnClose(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onClose = fn
+}
+
+// SessionID returns the session ID assigned by the remote server, if any.
+func (t *Transport) SessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// Start validates the endpoint URL. Requests are made lazily by Send.
+func (t *Transport) Start(ctx context.Context) error {
+	u, err := url.Parse(t.opts.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// Send posts the message to the remote server. Initialize is sent
+// synchronously so the session ID is known before anything else goes out;
+// other requests are posted in the background and their responses, or a
+// JSON-RPC error if the POST fails, arrive through OnMessage.
+func (t *Transport) Send(ctx context.Context, msg mcp.Message) error {
+	raw := msg.Bytes()
+	var req mcp.Request
+	_ = json.Unmarshal(raw, &req)
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return errClosed
+	}
+	switch req.Method {
+	case "initialize":
+		t.initRequest = raw
+		t.initID = string(req.ID)
+	case "notifications/initialized":
+		t.initialized = raw
+	}
+	isRequest := req.Method != "" && len(req.ID) > 0
+	if isRequest {
+		t.pending[string(req.ID)] = struct{}{}
+	}
+	background := isRequest && req.Method != "initialize"
+	if background {
+		t.wg.Add(1)
+	}
+	t.mu.Unlock()
+
+	if !background {
+		err := t.post(ctx, raw, req.Method == "initialize")
+		if req.Method == "initialize" {
+			t.takePending(req.ID)
+			if err == nil {
+				t.startListener()
+			}
+		}
+		return err
+	}
+
+	go func() {
+		defer t.wg.Done()
+		if err := t.post(t.ctx, raw, false); err != nil && t.ctx.Err() == nil && t.takePending(req.ID) {
+			log.Printf("[mcp-proxy] DEBUG: POST for request %s failed: %v", req.ID, err)
+			t.deliver(buildError(req.ID, err))
+		}
+	}()
+	return nil
+}
+
+// Close aborts outstanding requests and closes the transport.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	onClose := t.onClose
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	t.cancel()
+	t.wg.Wait()
+
+	if sessionID != "" {
+		t.terminateSession()
+	}
+
+	if onClose != nil {
+		onClose()
+	}
+	return nil
+}
+
+// post sends one payload, retrying transient failures and re-establishing an
+// expired session.
+func (t *Transport) post(ctx context.Context, raw []byte, initialize bool) error {
+	backoff := t.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		t.mu.Lock()
+		sessionID := t.sessionID
+		t.mu.Unlock()
+
+		resp, err := t.do(ctx, http.MethodPost, raw)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= t.opts.MaxRetries || !(idempotent(raw) || notSent(err)) {
+				return err
+			}
+			log.Printf("[mcp-proxy] DEBUG: POST failed, retrying in %s: %v", backoff, err)
+			if err := sleep(ctx, backoff); err != nil {
+				return err
+			}
+			backoff *= 2
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound && sessionID != "" && !initialize && attempt < t.opts.MaxRetries:
+			resp.Body.Close()
+			log.Printf("[mcp-proxy] INFO: remote session %s expired, reinitializing", sessionID)
+			if err := t.reinitialize(ctx, sessionID); err != nil {
+				return fmt.Errorf("session expired and reinitialize failed: %w", err)
+			}
+			continue
+
+		case retryable(resp.StatusCode, idempotent(raw)) && attempt < t.opts.MaxRetries:
+			delay := retryAfter(resp, backoff)
+			resp.Body.Close()
+			log.Printf("[mcp-proxy] DEBUG: server returned %s, retrying in %s", resp.Status, delay)
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+			backoff *= 2
+			continue
+
+		case resp.StatusCode >= http.StatusBadRequest:
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+			return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(body))
+		}
+
+		t.captureSession(resp)
+		defer resp.Body.Close()
+		// Event IDs of a POST stream belong to that stream and must not be
+		// used to resume the GET stream.
+		if err := t.readResponse(resp, t.handle, nil); err != nil {
+			return err
+		}
+		if id := requestID(raw); id != nil && t.isPending(id) && !t.streaming() && !initialize {
+			return errors.New("response stream ended before the response arrived")
+		}
+		return nil
+	}
+}
+
+func (t *Transport) do(ctx context.Context, method string, body []byte) (*http.Response, error) {
+	req, err := t.newRequest(ctx, method, body)
+	if err != nil {
+		return nil, err
+	}
+	return t.opts.Client.Do(req)
+}
+
+func (t *Transport) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.opts.URL, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range t.opts.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionHeader, t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set(versionHeader, t.protocolVersion)
+	}
+	t.mu.Unlock()
+
+	return req, nil
+}
+
+func (t *Transport) captureSession(resp *http.Response) {
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+}
+
+// readResponse passes every message in a JSON or SSE response body to fn and
+// the ID of every SSE event to onEventID, if set.
+func (t *Transport) readResponse(resp *http.Response, fn func([]byte), onEventID func(string)) error {
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		return readEvents(resp.Body, func(ev event) {
+			if ev.ID != "" && onEventID != nil {
+				onEventID(ev.ID)
+			}
+			if ev.Event == "" || ev.Event == "message" {
+				fn([]byte(ev.Data))
+			}
+		})
+
+	case "application/json":
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			return nil
+		}
+		msgs, _, err := mcp.SplitBatch(body)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			fn(msg)
+		}
+		return nil
+
+	default:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+}
+
+// handle delivers an inbound message, remembering the negotiated protocol
+// version from the initialize response. Responses to requests that are no
+// longer pending are dropped: a request whose POST failed has already been
+// answered with an error.
+func (t *Transport) handle(raw []byte) {
+	var resp struct {
+		mcp.Response
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(raw, &resp); err == nil && len(resp.ID) > 0 && resp.Method == "" {
+		if !t.takePending(resp.ID) {
+			return
+		}
+		t.mu.Lock()
+		if t.initID != "" && string(resp.ID) == t.initID {
+			t.protocolVersion = protocolVersionOf(resp.Result)
+		}
+		t.mu.Unlock()
+	}
+	t.deliver(raw)
+}
+
+func (t *Transport) takePending(id json.RawMessage) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[string(id)]; !ok {
+		return false
+	}
+	delete(t.pending, string(id))
+	return true
+}
+
+func (t *Transport) isPending(id json.RawMessage) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.pending[string(id)]
+	return ok
+}
+
+// streaming reports whether a GET stream is open for the current session, in
+// which case a response missing from a broken POST stream can still arrive.
+func (t *Transport) streaming() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.listenFor != "" && t.listenFor == t.sessionID
+}
+
+// startListener opens the GET stream for the current session unless one is
+// already open or the server does not offer it.
+func (t *Transport) startListener() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.noStream || t.sessionID == "" || t.listenFor == t.sessionID {
+		return
+	}
+	t.listenFor = t.sessionID
+	t.wg.Add(1)
+	go t.listen(t.sessionID)
+}
+
+// listen keeps a GET stream open for session, reconnecting with
+// Last-Event-ID whenever it drops, until the session changes or the
+// transport closes.
+func (t *Transport) listen(session string) {
+	defer t.wg.Done()
+	defer func() {
+		t.mu.Lock()
+		if t.listenFor == session {
+			t.listenFor = ""
+		}
+		t.mu.Unlock()
+	}()
+
+	backoff := t.opts.RetryBackoff
+	for {
+		t.mu.Lock()
+		current, lastEventID := t.sessionID, t.streamEventID
+		t.mu.Unlock()
+		if current != session || t.ctx.Err() != nil {
+			return
+		}
+
+		req, err := t.newRequest(t.ctx, http.MethodGet, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := t.opts.Client.Do(req)
+		switch {
+		case err != nil:
+			log.Printf("[mcp-proxy] DEBUG: GET stream failed: %v", err)
+		case resp.StatusCode == http.StatusMethodNotAllowed:
+			resp.Body.Close()
+			t.mu.Lock()
+			t.noStream = true
+			t.mu.Unlock()
+			return
+		case resp.StatusCode == http.StatusNotFound:
+			// The session is gone; the next POST re-establishes it and
+			// opens a new stream.
+			resp.Body.Close()
+			return
+		case resp.StatusCode >= http.StatusBadRequest:
+			resp.Body.Close()
+			log.Printf("[mcp-proxy] DEBUG: GET stream returned %s", resp.Status)
+		default:
+			backoff = t.opts.RetryBackoff
+			err = t.readResponse(resp, t.handle, func(id string) {
+				t.mu.Lock()
+				if t.sessionID == session {
+					t.streamEventID = id
+				}
+				t.mu.Unlock()
+			})
+			resp.Body.Close()
+			if err != nil && t.ctx.Err() == nil {
+				log.Printf("[mcp-proxy] DEBUG: GET stream dropped: %v", err)
+			}
+		}
+
+		if err := sleep(t.ctx, backoff); err != nil {
+			return
+		}
+		if backoff < maxStreamBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// terminateSession asks the server to end the session.
+func (t *Transport) terminateSession() {
+	ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+	defer cancel()
+
+	resp, err := t.do(ctx, http.MethodDelete, nil)
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: DELETE of remote session failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// reinitialize replays the cached initialize handshake after the server
+// dropped expired. The initialize response is not delivered since the peer
+// already received one.
+func (t *Transport) reinitialize(ctx context.Context, expired string) error {
+	t.reinitMu.Lock()
+	defer t.reinitMu.Unlock()
+
+	t.mu.Lock()
+	if t.sessionID != expired {
+		// Another request already re-established the session.
+		t.mu.Unlock()
+		return nil
+	}
+	t.sessionID = ""
+	t.streamEventID = ""
+	initRequest, initialized := t.initRequest, t.initialized
+	t.mu.Unlock()
+
+	if initRequest == nil {
+		return errors.New("no initialize request to replay")
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(initRequest, &req); err != nil {
+		return err
+	}
+	replayID := fmt.Sprintf(`"mcp-proxy-reinit-%d"`, t.seq.Add(1))
+	req["id"] = json.RawMessage(replayID)
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.do(ctx, http.MethodPost, raw)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	t.captureSession(resp)
+
+	var replyErr error
+	err = t.readResponse(resp, func(msg []byte) {
+		var reply mcp.Response
+		if json.Unmarshal(msg, &reply) == nil && string(reply.ID) == replayID {
+			if reply.Error != nil {
+				replyErr = errors.New(reply.Error.Message)
+			}
+			return
+		}
+		t.handle(msg)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if replyErr != nil {
+		return replyErr
+	}
+
+	if initialized != nil {
+		resp, err := t.do(ctx, http.MethodPost, initialized)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("server returned %s", resp.Status)
+		}
+	}
+	t.startListener()
+	return nil
+}
+
+func (t *Transport) deliver(raw []byte) {
+	t.mu.Lock()
+	onMessage := t.onMessage
+	t.mu.Unlock()
+	if onMessage != nil {
+		onMessage(mcp.NewMessage(raw))
+	}
+}
+
+func requestID(raw []byte) json.RawMessage {
+	var req mcp.Request
+	if err := json.Unmarshal(raw, &req); err != nil || req.Method == "" {
+		return nil
+	}
+	return req.ID
+}
+
+// retryable reports whether a POST answered with status may be sent again.
+// A 502 or 504 may come from a proxy after the server already processed the
+// request, so only idempotent messages are retried after one.
+func retryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// idempotent reports whether sending raw twice has the same effect as
+// sending it once. Notifications, responses and requests that only read or
+// set state are; anything else, tools/call in particular, is not.
+func idempotent(raw []byte) bool {
+	var req mcp.Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return false
+	}
+	if req.Method == "" || len(req.ID) == 0 {
+		return true
+	}
+	switch req.Method {
+	case "initialize", "ping", "tools/list", "prompts/list", "prompts/get",
+		"resources/list", "resources/templates/list", "resources/read",
+		"resources/subscribe", "resources/unsubscribe", "logging/setLevel",
+		"completion/complete":
+		return true
+	}
+	return false
+}
+
+// notSent reports whether err shows that the request never reached the
+// server, so that even a non-idempotent request can be sent again.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func protocolVersionOf(result json.RawMessage) string {
+	var r struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(result, &r)
+	return r.ProtocolVersion
+}
+
+func buildError(id json.RawMessage, err error) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]any{
+			"code":    -32603,
+			"message": err.Error(),
+		},
+	})
+	return raw
+}
@@ -0,0 +1,112 @@
+package httpserver
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// forwardedHeader marks a request forwarded by another replica. The owner
+// answers it itself, so a stale registry entry cannot bounce a request
+// between replicas.
+const forwardedHeader = "X-MCP-Proxy-Forwarded"
+
+// forward relays a request for a session held by another replica to its
+// owner and reports whether it did. Requests for local or unknown sessions
+// are left to the handlers.
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, m *mount, path string) bool {
+	if s.opts.Registry == nil || r.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+
+	sessionID := r.Header.Get("mcp-session-id")
+	if path == s.opts.MessageEndpoint {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+	if sessionID == "" {
+		return false
+	}
+	if _, ok := m.sessions.Load(sessionID); ok {
+		return false
+	}
+
+	owner, err := s.opts.Registry.Lookup(sessionID)
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: Session registry lookup for %s failed: %v", sessionID, err)
+		return false
+	}
+	if owner == "" || owner == s.opts.AdvertiseURL {
+		return false
+	}
+
+	proxy, err := s.proxyTo(owner)
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: invalid owner %q of session %s: %v", owner, sessionID, err)
+		return false
+	}
+	log.Printf("[mcp-proxy] DEBUG: Forwarding %s %s for session %s to %s", r.Method, r.URL.Path, sessionID, owner)
+	proxy.ServeHTTP(w, r)
+	return true
+}
+
+// proxyTo returns the reverse proxy for an owner's base URL.
+func (s *Server) proxyTo(owner string) (*httputil.ReverseProxy, error) {
+	if proxy, ok := s.proxies.Load(owner); ok {
+		return proxy.(*httputil.ReverseProxy), nil
+	}
+
+	target, err := url.Parse(owner)
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(forwardedHeader, s.opts.AdvertiseURL)
+		},
+		// Stream SSE responses as they are written.
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			// handle already set CORS headers for the client.
+			for _, name := range []string{
+				"Access-Control-Allow-Origin",
+				"Access-Control-Allow-Credentials",
+				"Access-Control-Allow-Methods",
+				"Access-Control-Allow-Headers",
+				"Access-Control-Expose-Headers",
+			} {
+				resp.Header.Del(name)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("[mcp-proxy] ERROR: forwarding to %s failed: %v", owner, err)
+			if s.ownerGone(r, owner) {
+				// A client treats 404 as the end of its session and
+				// initializes a new one.
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("session not found"))
+				return
+			}
+			// The owner may only be restarting or briefly unreachable, so
+			// the session is not given up on.
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("session owner unreachable"))
+		},
+	}
+	actual, _ := s.proxies.LoadOrStore(owner, proxy)
+	return actual.(*httputil.ReverseProxy), nil
+}
+
+// ownerGone reports whether the registry confirms that owner no longer holds
+// the session of a request that could not be forwarded to it.
+func (s *Server) ownerGone(r *http.Request, owner string) bool {
+	sessionID := r.Header.Get("mcp-session-id")
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+	current, err := s.opts.Registry.Lookup(sessionID)
+	return err == nil && current != owner
+}
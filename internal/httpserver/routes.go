@@ -0,0 +1,172 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/auth"
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// Route mounts a named server under RoutePrefix, so that one listener serves
+// several servers at paths like /servers/github/mcp and /servers/fs/mcp. The
+// stream, SSE, message and WebSocket endpoints are all available below the
+// route's path.
+type Route struct {
+	Name string
+	// APIKey is required on the route's requests instead of Options.APIKey.
+	// An empty key keeps Options.APIKey.
+	APIKey          string
+	Stateless       bool
+	CreateTransport func(ctx context.Context, r *http.Request) (mcp.Transport, error)
+}
+
+// mount is a set of endpoints with its own transports and sessions: the
+// top-level endpoints or one Route. Session IDs are only valid on the mount
+// that issued them.
+type mount struct {
+	base     string
+	settings atomic.Pointer[mountSettings]
+	sessions sync.Map // sessionID -> *session
+}
+
+// mountSettings are the parts of a mount that Reload replaces.
+type mountSettings struct {
+	auth            *auth.Middleware
+	stateless       bool
+	createTransport func(ctx context.Context, r *http.Request) (mcp.Transport, error)
+}
+
+func (m *mount) current() *mountSettings {
+	return m.settings.Load()
+}
+
+// sessionLimits are the session limits that Reload replaces.
+type sessionLimits struct {
+	maxSessions int
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+}
+
+func limitsOf(opts Options) *sessionLimits {
+	return &sessionLimits{
+		maxSessions: opts.MaxSessions,
+		idleTimeout: opts.SessionIdleTimeout,
+		maxLifetime: opts.SessionMaxLifetime,
+	}
+}
+
+// settingsOf validates opts and returns the settings of the top-level mount
+// and of every route.
+func settingsOf(opts Options) (*mountSettings, map[string]*mountSettings, error) {
+	root := &mountSettings{
+		auth:            auth.New(auth.Config{APIKey: opts.APIKey}),
+		stateless:       opts.Stateless,
+		createTransport: opts.CreateTransport,
+	}
+
+	routes := make(map[string]*mountSettings, len(opts.Routes))
+	for _, route := range opts.Routes {
+		if route.Name == "" || strings.Contains(route.Name, "/") {
+			return nil, nil, fmt.Errorf("invalid route name %q", route.Name)
+		}
+		if _, dup := routes[route.Name]; dup {
+			return nil, nil, fmt.Errorf("duplicate route %q", route.Name)
+		}
+		if route.CreateTransport == nil {
+			return nil, nil, fmt.Errorf("route %q has no CreateTransport", route.Name)
+		}
+		apiKey := route.APIKey
+		if apiKey == "" {
+			apiKey = opts.APIKey
+		}
+		routes[route.Name] = &mountSettings{
+			auth:            auth.New(auth.Config{APIKey: apiKey}),
+			stateless:       route.Stateless,
+			createTransport: route.CreateTransport,
+		}
+	}
+	return root, routes, nil
+}
+
+// Reload applies the API key, CreateTransport, Stateless, Routes and session
+// limits of opts to the running server. Existing sessions keep the transport
+// they were created with; new sessions use the new settings. Sessions of
+// routes that are no longer configured are closed. The address, endpoints and
+// callbacks of opts are ignored.
+func (s *Server) Reload(opts Options) error {
+	root, routes, err := settingsOf(opts)
+	if err != nil {
+		return err
+	}
+
+	var removed []*mount
+	s.mu.Lock()
+	s.root.settings.Store(root)
+	for name, m := range s.routes {
+		if _, ok := routes[name]; !ok {
+			removed = append(removed, m)
+			delete(s.routes, name)
+		}
+	}
+	for name, settings := range routes {
+		m, ok := s.routes[name]
+		if !ok {
+			m = &mount{base: s.opts.RoutePrefix + "/" + name}
+			s.routes[name] = m
+		}
+		m.settings.Store(settings)
+	}
+	s.limits.Store(limitsOf(opts))
+	s.mu.Unlock()
+
+	for _, m := range removed {
+		m.sessions.Range(func(key, value any) bool {
+			_ = value.(*session).close(CloseReasonRouteRemoved)
+			return true
+		})
+	}
+	return nil
+}
+
+// mountFor returns the mount serving path and the path relative to it.
+// Paths below RoutePrefix that name no route belong to the top-level mount
+// and end up unhandled.
+func (s *Server) mountFor(path string) (*mount, string) {
+	rest, ok := strings.CutPrefix(path, s.opts.RoutePrefix+"/")
+	if !ok {
+		return s.root, path
+	}
+	name, endpoint, _ := strings.Cut(rest, "/")
+
+	s.mu.RLock()
+	m, ok := s.routes[name]
+	s.mu.RUnlock()
+	if !ok {
+		return s.root, path
+	}
+	return m, "/" + endpoint
+}
+
+// eachSession calls fn for every registered session of every mount.
+func (s *Server) eachSession(fn func(*session)) {
+	s.mu.RLock()
+	mounts := make([]*mount, 0, len(s.routes)+1)
+	mounts = append(mounts, s.root)
+	for _, m := range s.routes {
+		mounts = append(mounts, m)
+	}
+	s.mu.RUnlock()
+
+	for _, m := range mounts {
+		m.sessions.Range(func(key, value any) bool {
+			fn(value.(*session))
+			return true
+		})
+	}
+}
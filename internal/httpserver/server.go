@@ -10,19 +10,24 @@ package httpserver
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
-	"github.com/sabbour/mcp-proxy-go/internal/auth"
 	"github.com/sabbour/mcp-proxy-go/internal/eventstore"
 	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/registry"
+	"github.com/sabbour/mcp-proxy-go/internal/websocket"
 )
 
 // generateSessionID creates a new unique session ID
@@ -30,28 +35,120 @@ func generateSessionID() string {
 	return uuid.New().String()
 }
 
+// CloseReason describes why a session was closed.
+type CloseReason string
+
+const (
+	// CloseReasonClient means the client ended the session, by DELETE or by
+	// disconnecting a legacy SSE stream.
+	CloseReasonClient CloseReason = "client"
+	// CloseReasonTransport means the underlying transport closed, typically
+	// because the stdio process exited.
+	CloseReasonTransport CloseReason = "transport"
+	// CloseReasonStateless means a stateless request completed.
+	CloseReasonStateless CloseReason = "stateless"
+	// CloseReasonIdle means the session saw no activity for SessionIdleTimeout.
+	CloseReasonIdle CloseReason = "idle"
+	// CloseReasonLifetime means the session outlived SessionMaxLifetime.
+	CloseReasonLifetime CloseReason = "max-lifetime"
+	// CloseReasonShutdown means the server is shutting down.
+	CloseReasonShutdown CloseReason = "shutdown"
+	// CloseReasonRouteRemoved means Reload removed the session's route.
+	CloseReasonRouteRemoved CloseReason = "route-removed"
+)
+
+var (
+	// errTooManySessions is returned by createSession when MaxSessions is reached.
+	errTooManySessions = errors.New("too many sessions")
+	// errShuttingDown is returned by createSession once Close has been called.
+	errShuttingDown = errors.New("server shutting down")
+
+	// ErrUnavailable may be wrapped by errors returned from CreateTransport
+	// to turn the client away with 503 and Retry-After instead of 500.
+	ErrUnavailable = errors.New("no server process available")
+)
+
+// retryAfterSeconds is advertised to clients turned away by MaxSessions.
+const retryAfterSeconds = 5
+
 // Options configure the HTTP proxy server.
 type Options struct {
-	Host               string
-	Port               int
-	APIKey             string
-	CreateTransport    func(ctx context.Context, r *http.Request) (mcp.Transport, error)
-	EventStoreFactory  func() *eventstore.Memory
+	Host            string
+	Port            int
+	APIKey          string
+	CreateTransport func(ctx context.Context, r *http.Request) (mcp.Transport, error)
+	// EventStoreFactory returns the store of a new stateful session. It may
+	// return the same store for every session; a session's stream is deleted
+	// when it closes.
+	EventStoreFactory  func() eventstore.EventStore
 	StreamEndpoint     string
 	SSEEndpoint        string
+	MessageEndpoint    string
+	MetricsEndpoint    string
+	WebSocketEndpoint  string
 	Stateless          bool
 	EnableJSONResponse bool
 	OnConnect          func(sessionID string)
-	OnClose            func(sessionID string)
+	OnClose            func(sessionID string, reason CloseReason)
 	OnUnhandled        func(http.ResponseWriter, *http.Request)
+
+	// SessionIdleTimeout closes sessions without client activity or open
+	// streams for this long. Zero disables idle expiry.
+	SessionIdleTimeout time.Duration
+	// SessionMaxLifetime closes sessions this long after creation regardless
+	// of activity. Zero disables the limit.
+	SessionMaxLifetime time.Duration
+	// MaxSessions caps concurrently live sessions; further session requests
+	// get 503 with Retry-After. Zero means unlimited.
+	MaxSessions int
+
+	// TerminateTimeout is how long a transport may take to exit once its
+	// session is closed, such as a child process's grace period between
+	// SIGTERM and SIGKILL. Close waits that long plus killWait for the
+	// transports, whatever is left of its context. Defaults to 5s.
+	TerminateTimeout time.Duration
+
+	// WebSocketPingInterval is how often WebSocket clients are pinged; a
+	// client that stays silent for two intervals is disconnected. Defaults
+	// to 30s.
+	WebSocketPingInterval time.Duration
+	// WebSocketOrigins lists the hosts, such as "app.example.com" or
+	// "*.example.com", whose browser pages may open WebSockets besides the
+	// proxy's own host. Upgrades from any other Origin get 403.
+	WebSocketOrigins []string
+
+	// Metrics appends extra Prometheus text-format metrics to the response
+	// served on MetricsEndpoint.
+	Metrics func(w io.Writer)
+
+	// Routes mounts further named servers below RoutePrefix, each with its
+	// own transports, API key, stateless setting and sessions. RoutePrefix
+	// defaults to "/servers".
+	Routes      []Route
+	RoutePrefix string
+
+	// Registry records the sessions of this replica so that other replicas
+	// sharing it forward requests for them here, and lets this replica
+	// forward requests for sessions it does not hold to their owner.
+	// AdvertiseURL is the base URL other replicas reach this one at, such
+	// as "http://10.0.0.5:3000", and is required with a Registry.
+	Registry     registry.Registry
+	AdvertiseURL string
 }
 
 // Server represents the running HTTP proxy.
 type Server struct {
 	server   *http.Server
 	opts     Options
-	auth     *auth.Middleware
-	sessions sync.Map // sessionID -> *session
+	root     *mount
+	mu       sync.RWMutex
+	routes   map[string]*mount
+	limits   atomic.Pointer[sessionLimits]
+	live     atomic.Int64
+	draining atomic.Bool
+	done     chan struct{}
+	doneOnce sync.Once
+	proxies  sync.Map // owner URL -> *httputil.ReverseProxy
 }
 
 // Start creates and runs the HTTP server.
@@ -62,10 +159,43 @@ func Start(opts Options) (*Server, error) {
 	if opts.SSEEndpoint == "" {
 		opts.SSEEndpoint = "/sse"
 	}
+	if opts.MessageEndpoint == "" {
+		opts.MessageEndpoint = "/messages"
+	}
+	if opts.MetricsEndpoint == "" {
+		opts.MetricsEndpoint = "/metrics"
+	}
+	if opts.WebSocketEndpoint == "" {
+		opts.WebSocketEndpoint = "/ws"
+	}
+	if opts.TerminateTimeout <= 0 {
+		opts.TerminateTimeout = defaultTerminateTimeout
+	}
+	if opts.WebSocketPingInterval <= 0 {
+		opts.WebSocketPingInterval = websocket.DefaultPingInterval
+	}
+	if opts.RoutePrefix == "" {
+		opts.RoutePrefix = "/servers"
+	}
+	opts.RoutePrefix = strings.TrimSuffix(opts.RoutePrefix, "/")
+	if opts.Registry != nil && opts.AdvertiseURL == "" {
+		return nil, errors.New("a session registry needs AdvertiseURL")
+	}
+	opts.AdvertiseURL = strings.TrimSuffix(opts.AdvertiseURL, "/")
 
-	authMiddleware := auth.New(auth.Config{APIKey: opts.APIKey})
+	rootSettings, routeSettings, err := settingsOf(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	s := &Server{opts: opts, auth: authMiddleware}
+	s := &Server{opts: opts, root: &mount{}, routes: map[string]*mount{}, done: make(chan struct{})}
+	s.root.settings.Store(rootSettings)
+	for name, settings := range routeSettings {
+		m := &mount{base: opts.RoutePrefix + "/" + name}
+		m.settings.Store(settings)
+		s.routes[name] = m
+	}
+	s.limits.Store(limitsOf(opts))
 
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", opts.Host, opts.Port),
@@ -80,20 +210,110 @@ func Start(opts Options) (*Server, error) {
 		}
 	}()
 
+	// Limits may be enabled by Reload later, so the reaper always runs.
+	go s.reap()
+
 	// Wait briefly for the server to bind.
 	time.Sleep(50 * time.Millisecond)
 
 	return s, nil
 }
 
-// Close gracefully shuts down the server.
+// defaultTerminateTimeout is used when Options.TerminateTimeout is zero.
+const defaultTerminateTimeout = 5 * time.Second
+
+// killWait is how long Close allows for a transport to exit after its
+// TerminateTimeout, when it has been killed.
+const killWait = 2 * time.Second
+
+// Close gracefully shuts down the server. It stops accepting new sessions,
+// ends open SSE streams with a shutdown notice, lets in-flight requests finish
+// until ctx expires, and then closes every session and waits for the
+// transports to exit. Draining may use up ctx, so the transports get their
+// own TerminateTimeout plus killWait.
 func (s *Server) Close(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	s.draining.Store(true)
+	s.doneOnce.Do(func() { close(s.done) })
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: HTTP shutdown did not complete: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	s.eachSession(func(sess *session) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sess.close(CloseReasonShutdown)
+		}()
+	})
+
+	closed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(closed)
+	}()
+
+	wait := time.NewTimer(s.opts.TerminateTimeout + killWait)
+	defer wait.Stop()
+	select {
+	case <-closed:
+	case <-wait.C:
+		if err == nil {
+			err = errors.New("timed out waiting for sessions to close")
+		}
+	}
+
+	return err
+}
+
+// reap periodically closes sessions that exceeded their idle timeout or
+// maximum lifetime.
+func (s *Server) reap() {
+	limits := s.limits.Load()
+	ticker := time.NewTicker(reapInterval(limits.idleTimeout, limits.maxLifetime))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			if current := s.limits.Load(); current != limits {
+				limits = current
+				ticker.Reset(reapInterval(limits.idleTimeout, limits.maxLifetime))
+			}
+			if limits.idleTimeout <= 0 && limits.maxLifetime <= 0 {
+				continue
+			}
+			s.eachSession(func(sess *session) {
+				if reason, ok := sess.expired(now, limits.idleTimeout, limits.maxLifetime); ok {
+					log.Printf("[mcp-proxy] DEBUG: Reaping session %s (%s)", sess.id, reason)
+					_ = sess.close(reason)
+				}
+			})
+		}
+	}
+}
+
+// reapInterval checks a few times per configured limit, within sane bounds.
+func reapInterval(limits ...time.Duration) time.Duration {
+	interval := 30 * time.Second
+	for _, limit := range limits {
+		if limit > 0 && limit/4 < interval {
+			interval = limit / 4
+		}
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
 }
 
 func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[mcp-proxy] DEBUG: Incoming request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-	
+
 	// Set CORS headers
 	origin := r.Header.Get("Origin")
 	if origin != "" {
@@ -103,7 +323,7 @@ func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, mcp-session-id")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, mcp-session-id, Last-Event-ID")
 	w.Header().Set("Access-Control-Expose-Headers", "mcp-session-id")
 
 	if r.Method == http.MethodOptions {
@@ -119,10 +339,13 @@ func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	m, path := s.mountFor(r.URL.Path)
+	settings := m.current()
+
 	log.Printf("[mcp-proxy] DEBUG: Validating authentication")
-	if !s.auth.Validate(r) {
+	if !settings.auth.Validate(r) {
 		log.Printf("[mcp-proxy] DEBUG: Authentication failed")
-		code, headers, body := s.auth.UnauthorizedResponse()
+		code, headers, body := settings.auth.UnauthorizedResponse()
 		for k, vals := range headers {
 			for _, v := range vals {
 				w.Header().Add(k, v)
@@ -134,29 +357,54 @@ func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("[mcp-proxy] DEBUG: Authentication passed")
 
+	if s.forward(w, r, m, path) {
+		return
+	}
+
 	switch {
-	case r.URL.Path == s.opts.StreamEndpoint:
-		log.Printf("[mcp-proxy] DEBUG: Routing to stream endpoint (%s) with method %s", s.opts.StreamEndpoint, r.Method)
-		s.handleStream(w, r)
-	case r.URL.Path == s.opts.SSEEndpoint:
-		log.Printf("[mcp-proxy] DEBUG: Routing to SSE endpoint (%s)", s.opts.SSEEndpoint)
-		s.handleSSE(w, r)
+	case m == s.root && path == s.opts.MetricsEndpoint && r.Method == http.MethodGet:
+		s.handleMetrics(w)
+	case settings.createTransport == nil:
+		// Only routes are configured; the top-level endpoints serve nothing.
+		s.unhandled(w, r)
+	case path == s.opts.StreamEndpoint:
+		log.Printf("[mcp-proxy] DEBUG: Routing to stream endpoint (%s%s) with method %s", m.base, s.opts.StreamEndpoint, r.Method)
+		s.handleStream(w, r, m)
+	case path == s.opts.SSEEndpoint:
+		log.Printf("[mcp-proxy] DEBUG: Routing to SSE endpoint (%s%s)", m.base, s.opts.SSEEndpoint)
+		s.handleSSE(w, r, m)
+	case path == s.opts.MessageEndpoint:
+		log.Printf("[mcp-proxy] DEBUG: Routing to message endpoint (%s%s)", m.base, s.opts.MessageEndpoint)
+		s.handleMessages(w, r, m)
+	case path == s.opts.WebSocketEndpoint:
+		log.Printf("[mcp-proxy] DEBUG: Routing to WebSocket endpoint (%s%s)", m.base, s.opts.WebSocketEndpoint)
+		s.handleWebSocket(w, r, m)
 	default:
 		log.Printf("[mcp-proxy] DEBUG: No matching endpoint for %s, available: %s, %s", r.URL.Path, s.opts.StreamEndpoint, s.opts.SSEEndpoint)
-		if s.opts.OnUnhandled != nil {
-			s.opts.OnUnhandled(w, r)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
-		}
+		s.unhandled(w, r)
 	}
 }
 
-func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+func (s *Server) unhandled(w http.ResponseWriter, r *http.Request) {
+	if s.opts.OnUnhandled != nil {
+		s.opts.OnUnhandled(w, r)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, m *mount) {
 	log.Printf("[mcp-proxy] DEBUG: handleStream called with method %s", r.Method)
-	
+
 	if r.Method == http.MethodDelete {
 		log.Printf("[mcp-proxy] DEBUG: Handling DELETE request")
-		s.handleDelete(w, r)
+		s.handleDelete(w, r, m)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		log.Printf("[mcp-proxy] DEBUG: Handling GET request")
+		s.handleStreamGet(w, r, m)
 		return
 	}
 
@@ -188,54 +436,58 @@ func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[mcp-proxy] DEBUG: Session ID from header: '%s'", sessionID)
 
 	if sessionID == "" {
+		stateless := m.current().stateless
 		log.Printf("[mcp-proxy] DEBUG: No session ID, checking if initialize request")
-		if !mcp.IsInitializeRequest(body) && !s.opts.Stateless {
+		if !mcp.IsInitializeRequest(body) && !stateless {
 			log.Printf("[mcp-proxy] DEBUG: Not initialize request and not stateless - returning bad request")
 			w.WriteHeader(http.StatusBadRequest)
 			_, _ = w.Write([]byte("missing session id"))
 			return
 		}
 
-		sess, newID, err := s.createSession(r.Context(), r)
+		mode := sessionStateful
+		if stateless {
+			mode = sessionStateless
+		}
+		sess, newID, err := s.createSession(r.Context(), r, m, mode)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = w.Write([]byte(err.Error()))
+			writeSessionError(w, err)
 			return
 		}
 
-		if !s.opts.Stateless {
+		if !stateless {
 			w.Header().Set("mcp-session-id", newID)
 			log.Printf("[mcp-proxy] DEBUG: Set session ID header in response: '%s'", newID)
 		}
 
-		resp, err := sess.request(r.Context(), body)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = w.Write([]byte(err.Error()))
-			return
-		}
-
-		if resp != nil {
-			s.writeJSONResponse(w, resp)
-		} else {
-			w.WriteHeader(http.StatusNoContent)
-		}
+		s.respond(w, r, sess, body)
 
-		if s.opts.Stateless {
-			_ = sess.close()
+		if stateless {
+			_ = sess.close(CloseReasonStateless)
 		}
 
 		return
 	}
 
-	sessAny, ok := s.sessions.Load(sessionID)
+	sessAny, ok := m.sessions.Load(sessionID)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = w.Write([]byte("session not found"))
 		return
 	}
 
-	sess := sessAny.(*session)
+	s.respond(w, r, sessAny.(*session), body)
+}
+
+// respond dispatches the POSTed message to the session and writes the reply,
+// either as a single JSON body or as an SSE stream when the client accepts one.
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, sess *session, body []byte) {
+	defer sess.hold()()
+
+	if s.wantsEventStream(r) && mcp.HasRequests(body) {
+		s.respondStream(w, r, sess, body)
+		return
+	}
 
 	resp, err := sess.request(r.Context(), body)
 	if err != nil {
@@ -249,12 +501,48 @@ func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[mcp-proxy] DEBUG: Sending JSON response: %s", string(resp))
 		s.writeJSONResponse(w, resp)
 	} else {
-		log.Printf("[mcp-proxy] DEBUG: No response from stdio server - returning 204 (normal for notifications)")
-		w.WriteHeader(http.StatusNoContent)
+		log.Printf("[mcp-proxy] DEBUG: No response expected from stdio server - returning 202")
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *Server) respondStream(w http.ResponseWriter, r *http.Request, sess *session, body []byte) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	started := false
+	err := sess.stream(r.Context(), body, func(ev eventstore.Event) {
+		if !started {
+			writeSSEHeaders(w)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		writeSSE(w, ev)
+		flusher.Flush()
+	})
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: Session stream error: %v", err)
+		if !started {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+		}
+	}
+}
+
+// wantsEventStream reports whether a POST response may be streamed as SSE.
+func (s *Server) wantsEventStream(r *http.Request) bool {
+	if s.opts.EnableJSONResponse {
+		return false
 	}
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
 }
 
-func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+// handleStreamGet opens an SSE stream that delivers server-initiated messages
+// for an existing session.
+func (s *Server) handleStreamGet(w http.ResponseWriter, r *http.Request, m *mount) {
 	sessionID := r.Header.Get("mcp-session-id")
 	if sessionID == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -262,54 +550,102 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessAny, ok := s.sessions.Load(sessionID)
+	sessAny, ok := m.sessions.Load(sessionID)
 	if !ok {
+		if s.replayEnded(w, r, sessionID) {
+			return
+		}
 		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("session not found"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	sess := sessAny.(*session)
-	_ = sess.close()
+	events, backlog, unsubscribe := sess.subscribeFrom(r.Header.Get("Last-Event-ID"))
+	defer unsubscribe()
+
+	writeSSEHeaders(w)
+	w.Header().Set("mcp-session-id", sessionID)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Printf("[mcp-proxy] DEBUG: Opened GET stream for session %s (replaying %d events)", sessionID, len(backlog))
+
+	s.pumpEvents(r.Context(), w, sess, events, backlog, func(ev eventstore.Event) {
+		writeSSE(w, ev)
+	})
+}
+
+// replayEnded serves the events a durable store kept for a session that no
+// longer exists, such as one of an earlier run of the proxy, after the
+// client's Last-Event-ID, and then ends the stream. The client learns that
+// the session is gone from its next request and initializes a new one. It
+// reports whether there was anything to resume.
+func (s *Server) replayEnded(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" || s.opts.EventStoreFactory == nil {
+		return false
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return false
+	}
+
+	var replay []eventstore.Event
+	streamID := s.opts.EventStoreFactory().ReplayAfter(lastEventID, func(ev eventstore.Event) {
+		replay = append(replay, ev)
+	})
+	if streamID != sessionID {
+		return false
+	}
+
+	writeSSEHeaders(w)
+	w.Header().Set("mcp-session-id", sessionID)
+	w.WriteHeader(http.StatusOK)
+	for _, ev := range replay {
+		writeSSE(w, ev)
+	}
+	flusher.Flush()
+
+	log.Printf("[mcp-proxy] DEBUG: Replayed %d events of ended session %s", len(replay), sessionID)
+	return true
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, m *mount) {
+	sessionID := r.Header.Get("mcp-session-id")
+	if sessionID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("missing session id"))
+		return
+	}
+
+	sessAny, ok := m.sessions.Load(sessionID)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sess := sessAny.(*session)
+	_ = sess.close(CloseReasonClient)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request, m *mount) {
 	log.Printf("[mcp-proxy] DEBUG: handleSSE called with method %s, URL path: %s", r.Method, r.URL.Path)
-	
+
 	if r.Method != http.MethodGet {
 		log.Printf("[mcp-proxy] DEBUG: SSE handler only accepts GET requests, got %s", r.Method)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	log.Printf("[mcp-proxy] DEBUG: Creating SSE transport for endpoint %s", s.opts.SSEEndpoint)
-	
-	// Set SSE headers immediately
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	
-	// Create session ID
-	sessionID := generateSessionID()
-	log.Printf("[mcp-proxy] DEBUG: Generated session ID: %s", sessionID)
-	
-		// Create server using the callback
-	transport, err := s.opts.CreateTransport(r.Context(), r)
-	if err != nil {
-		log.Printf("[mcp-proxy] DEBUG: Error creating MCP transport: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Error creating server"))
-		return
-	}
-	
-	log.Printf("[mcp-proxy] DEBUG: Created MCP transport successfully")
-	
-	// Use the transport (simplified for now)
-	_ = transport
-	
-	// Set up event stream
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		log.Printf("[mcp-proxy] DEBUG: ResponseWriter doesn't support flushing")
@@ -317,76 +653,254 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Write 200 OK status
+	// Clients of the streamable transport may attach to an existing session to
+	// observe its event stream.
+	if sessionID := r.Header.Get("mcp-session-id"); sessionID != "" {
+		sessAny, ok := m.sessions.Load(sessionID)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("session not found"))
+			return
+		}
+
+		sess := sessAny.(*session)
+		events, backlog, unsubscribe := sess.subscribeFrom(r.Header.Get("Last-Event-ID"))
+		defer unsubscribe()
+
+		writeSSEHeaders(w)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		s.pumpEvents(r.Context(), w, sess, events, backlog, func(ev eventstore.Event) {
+			writeLegacySSE(w, ev)
+		})
+		return
+	}
+
+	log.Printf("[mcp-proxy] DEBUG: Creating SSE transport for endpoint %s", s.opts.SSEEndpoint)
+
+	// The legacy HTTP+SSE transport is inherently stateful, so the session is
+	// registered even in stateless mode.
+	sess, sessionID, err := s.createSession(r.Context(), r, m, sessionStateful)
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: Error creating MCP transport: %v", err)
+		writeSessionError(w, err)
+		return
+	}
+	defer func() {
+		reason := CloseReasonClient
+		if s.draining.Load() {
+			reason = CloseReasonShutdown
+		}
+		_ = sess.close(reason)
+	}()
+
+	events, _, unsubscribe := sess.subscribeFrom("")
+	defer unsubscribe()
+
+	writeSSEHeaders(w)
 	w.WriteHeader(http.StatusOK)
-	
-	// Send initial connection message matching TypeScript format
-	initialMsg := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"method":  "sse/connection",
-		"params": map[string]interface{}{
-			"message": "SSE Connection established",
-		},
-	}
-	
-	msgBytes, _ := json.Marshal(initialMsg)
-	fmt.Fprintf(w, "data: %s\n\n", msgBytes)
+
+	endpoint := fmt.Sprintf("%s%s?sessionId=%s", m.base, s.opts.MessageEndpoint, url.QueryEscape(sessionID))
+	fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", endpoint)
 	flusher.Flush()
-	
-	log.Printf("[mcp-proxy] DEBUG: Sent initial SSE connection message")
-	
-	// Keep connection alive
-	ctx := r.Context()
+
+	log.Printf("[mcp-proxy] DEBUG: Sent endpoint event for SSE session %s", sessionID)
+
+	s.pumpEvents(r.Context(), w, sess, events, nil, func(ev eventstore.Event) {
+		writeLegacySSE(w, ev)
+	})
+}
+
+// pumpEvents writes the replayed backlog followed by live session events
+// until the client disconnects, the session closes, or the subscriber is
+// dropped for falling behind.
+func (s *Server) pumpEvents(ctx context.Context, w http.ResponseWriter, sess *session, events chan eventstore.Event, backlog []eventstore.Event, write func(eventstore.Event)) {
+	defer sess.hold()()
+
+	flusher := w.(http.Flusher)
+
+	replayed := make(map[string]struct{}, len(backlog))
+	for _, ev := range backlog {
+		write(ev)
+		if ev.ID != "" {
+			replayed[ev.ID] = struct{}{}
+		}
+	}
+	flusher.Flush()
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf("[mcp-proxy] DEBUG: SSE connection closed by client")
 			return
+		case <-sess.ctx.Done():
+			log.Printf("[mcp-proxy] DEBUG: SSE session %s closed", sess.id)
+			return
+		case <-s.done:
+			log.Printf("[mcp-proxy] DEBUG: Closing SSE stream for session %s on shutdown", sess.id)
+			write(eventstore.Event{StreamID: sess.id, Payload: buildShutdownNotice()})
+			flusher.Flush()
+			return
+		case ev, ok := <-events:
+			if !ok {
+				log.Printf("[mcp-proxy] DEBUG: SSE subscriber for session %s fell behind, closing stream", sess.id)
+				return
+			}
+			if _, dup := replayed[ev.ID]; dup {
+				delete(replayed, ev.ID)
+				continue
+			}
+			write(ev)
+			flusher.Flush()
 		case <-ticker.C:
-			// Send keepalive
 			fmt.Fprintf(w, ": keepalive\n\n")
 			flusher.Flush()
 		}
 	}
 }
 
-func (s *Server) createSession(ctx context.Context, r *http.Request) (*session, string, error) {
-	if s.opts.CreateTransport == nil {
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request, m *mount) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("missing sessionId"))
+		return
+	}
+
+	sessAny, ok := m.sessions.Load(sessionID)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("session not found"))
+		return
+	}
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	sess := sessAny.(*session)
+	sess.touch()
+	sess.markAnswers(body)
+	if err := sess.send(r.Context(), body); err != nil {
+		log.Printf("[mcp-proxy] DEBUG: Error forwarding message to session %s: %v", sessionID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	// Replies are delivered asynchronously on the session's SSE stream.
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("Accepted"))
+}
+
+// handleMetrics serves session counts and any metrics contributed through
+// Options.Metrics in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "# HELP mcp_proxy_sessions Live MCP sessions.")
+	fmt.Fprintln(w, "# TYPE mcp_proxy_sessions gauge")
+	fmt.Fprintf(w, "mcp_proxy_sessions %d\n", s.live.Load())
+	if s.opts.Metrics != nil {
+		s.opts.Metrics(w)
+	}
+}
+
+// sessionMode controls whether a session is registered for lookup by ID and
+// whether it keeps an event store for resumable streams.
+type sessionMode int
+
+const (
+	// sessionStateful sessions are registered and record events for replay.
+	sessionStateful sessionMode = iota
+	// sessionStateless sessions serve a single request and are not registered.
+	sessionStateless
+	// sessionSocket sessions are registered but bound to one WebSocket, which
+	// cannot resume, so they record no events.
+	sessionSocket
+)
+
+func (s *Server) createSession(ctx context.Context, r *http.Request, m *mount, mode sessionMode) (*session, string, error) {
+	createTransport := m.current().createTransport
+	if createTransport == nil {
 		return nil, "", fmt.Errorf("CreateTransport not configured")
 	}
 
-	transport, err := s.opts.CreateTransport(ctx, r)
+	if s.draining.Load() {
+		return nil, "", errShuttingDown
+	}
+
+	maxSessions := s.limits.Load().maxSessions
+	if n := s.live.Add(1); maxSessions > 0 && n > int64(maxSessions) {
+		s.live.Add(-1)
+		return nil, "", errTooManySessions
+	}
+
+	transport, err := createTransport(ctx, r)
 	if err != nil {
+		s.live.Add(-1)
 		return nil, "", err
 	}
 
 	sessionID := uuid.NewString()
-	store := s.opts.EventStoreFactory
-	var mem *eventstore.Memory
-	if store != nil && !s.opts.Stateless {
-		mem = store()
+	var store eventstore.EventStore
+	if s.opts.EventStoreFactory != nil && mode == sessionStateful {
+		store = s.opts.EventStoreFactory()
 	}
 
-	finalize := func() {
-		if !s.opts.Stateless {
-			s.sessions.Delete(sessionID)
+	var registered atomic.Bool
+	finalize := func(reason CloseReason) {
+		s.live.Add(-1)
+		// A durable store keeps the streams of a shutdown for clients
+		// resuming against the next process.
+		if store != nil && reason != CloseReasonShutdown {
+			store.DeleteStream(sessionID)
+		}
+		if registered.Load() {
+			if err := s.opts.Registry.Unregister(sessionID); err != nil {
+				log.Printf("[mcp-proxy] ERROR: failed to unregister session %s: %v", sessionID, err)
+			}
+		}
+		if mode != sessionStateless {
+			m.sessions.Delete(sessionID)
 		}
 		if s.opts.OnClose != nil {
-			s.opts.OnClose(sessionID)
+			s.opts.OnClose(sessionID, reason)
 		}
 	}
 
-	sess := newSession(sessionID, transport, mem, finalize)
+	sess := newSession(sessionID, transport, store, finalize)
 
 	if err := sess.start(context.Background()); err != nil {
+		sess.cancel()
+		s.live.Add(-1)
 		return nil, "", err
 	}
 
-	if !s.opts.Stateless {
-		s.sessions.Store(sessionID, sess)
+	if mode != sessionStateless {
+		m.sessions.Store(sessionID, sess)
+	}
+
+	if s.opts.Registry != nil && mode == sessionStateful {
+		// A session that fails to register still works for clients that
+		// keep reaching this replica.
+		if err := s.opts.Registry.Register(sessionID, s.opts.AdvertiseURL); err != nil {
+			log.Printf("[mcp-proxy] ERROR: failed to register session %s: %v", sessionID, err)
+		} else {
+			registered.Store(true)
+		}
 	}
 
 	if s.opts.OnConnect != nil {
@@ -396,6 +910,18 @@ func (s *Server) createSession(ctx context.Context, r *http.Request) (*session,
 	return sess, sessionID, nil
 }
 
+func writeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTooManySessions) || errors.Is(err, errShuttingDown) || errors.Is(err, ErrUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = w.Write([]byte(err.Error()))
+}
+
 func (s *Server) writeJSONResponse(w http.ResponseWriter, payload []byte) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -408,3 +934,15 @@ func writeSSE(w http.ResponseWriter, ev eventstore.Event) {
 	}
 	fmt.Fprintf(w, "data: %s\n\n", ev.Payload)
 }
+
+// writeLegacySSE writes an event in the framing of the HTTP+SSE transport.
+func writeLegacySSE(w http.ResponseWriter, ev eventstore.Event) {
+	fmt.Fprintf(w, "event: message\n")
+	writeSSE(w, ev)
+}
+
+func writeSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
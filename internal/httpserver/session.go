@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sabbour/mcp-proxy-go/internal/eventstore"
@@ -17,29 +19,41 @@ import (
 type session struct {
 	id        string
 	transport mcp.Transport
-	pending   sync.Map // id(string) -> chan mcp.Message
+	callsMu   sync.Mutex
+	calls     map[string]*call // request id -> call awaiting its response
+	postSeq   atomic.Uint64
+	cancelled map[string]time.Time // request id -> time the call was abandoned
+	inbound   []serverRequest      // server-to-client requests awaiting an answer
 	events    chan eventstore.Event
 	subsMu    sync.Mutex
 	subs      map[chan eventstore.Event]struct{}
-	store     *eventstore.Memory
+	store     eventstore.EventStore
 	ctx       context.Context
 	cancel    context.CancelFunc
-	onClose   func()
+	onClose   func(CloseReason)
 	closeOnce sync.Once
+
+	createdAt  time.Time
+	lastActive atomic.Int64 // unix nanoseconds of the last client activity
+	busy       atomic.Int32 // in-flight requests and open streams; a busy session is never idle
 }
 
-func newSession(id string, transport mcp.Transport, store *eventstore.Memory, onClose func()) *session {
+func newSession(id string, transport mcp.Transport, store eventstore.EventStore, onClose func(CloseReason)) *session {
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &session{
 		id:        id,
 		transport: transport,
 		events:    make(chan eventstore.Event, 128),
+		calls:     map[string]*call{},
+		cancelled: map[string]time.Time{},
 		subs:      map[chan eventstore.Event]struct{}{},
 		store:     store,
 		ctx:       ctx,
 		cancel:    cancel,
 		onClose:   onClose,
+		createdAt: time.Now(),
 	}
+	s.touch()
 
 	transport.OnMessage(s.handleMessage)
 	transport.OnError(func(err error) {
@@ -50,12 +64,7 @@ func newSession(id string, transport mcp.Transport, store *eventstore.Memory, on
 		})
 	})
 	transport.OnClose(func() {
-		s.cancel()
-		s.closeOnce.Do(func() {
-			if s.onClose != nil {
-				s.onClose()
-			}
-		})
+		s.finish(CloseReasonTransport)
 	})
 
 	go s.run()
@@ -67,45 +76,207 @@ func (s *session) start(ctx context.Context) error {
 	return s.transport.Start(ctx)
 }
 
-func (s *session) close() error {
+func (s *session) close(reason CloseReason) error {
+	s.finish(reason)
+	return s.transport.Close()
+}
+
+// finish cancels the session and reports the first close reason.
+func (s *session) finish(reason CloseReason) {
 	s.cancel()
 	s.closeOnce.Do(func() {
 		if s.onClose != nil {
-			s.onClose()
+			s.onClose(reason)
 		}
 	})
-	return s.transport.Close()
+}
+
+// touch records client activity for idle expiry.
+func (s *session) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// hold marks the session busy until the returned release function is called.
+func (s *session) hold() func() {
+	s.touch()
+	s.busy.Add(1)
+	return func() {
+		s.touch()
+		s.busy.Add(-1)
+	}
+}
+
+// expired reports why the session should be reaped, if at all.
+func (s *session) expired(now time.Time, idleTimeout, maxLifetime time.Duration) (CloseReason, bool) {
+	if maxLifetime > 0 && now.Sub(s.createdAt) >= maxLifetime {
+		return CloseReasonLifetime, true
+	}
+
+	if idleTimeout > 0 && s.busy.Load() == 0 {
+		idle := now.Sub(time.Unix(0, s.lastActive.Load()))
+		if idle >= idleTimeout {
+			return CloseReasonIdle, true
+		}
+	}
+
+	return "", false
 }
 
 func (s *session) handleMessage(msg mcp.Message) {
 	raw := msg.Bytes()
 
-	var envelope map[string]json.RawMessage
+	var envelope struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
 	if err := json.Unmarshal(raw, &envelope); err != nil {
 		s.storeAndBroadcast(raw)
 		return
 	}
 
-	idRaw, hasID := envelope["id"]
-
-	if hasID {
-		idKey := string(idRaw)
-		if ch, ok := s.pending.Load(idKey); ok {
-			ch.(chan mcp.Message) <- msg
-			s.storeAndBroadcast(raw)
+	switch {
+	case envelope.Method == "" && len(envelope.ID) > 0:
+		if c := s.takeCall(string(envelope.ID)); c != nil {
+			// Responses belong to the caller's stream only; the GET
+			// stream never carries them.
+			c.respond(s.callEvent(c, raw))
 			return
 		}
+		if s.takeCancelled(string(envelope.ID)) {
+			log.Printf("[mcp-proxy] DEBUG: dropping late response for cancelled request %s", envelope.ID)
+			return
+		}
+	case envelope.Method == "notifications/progress":
+		if c := s.callForProgress(progressTokenOf(envelope.Params, false)); c != nil {
+			c.deliver(s.callEvent(c, raw))
+			return
+		}
+	case len(envelope.ID) > 0:
+		s.handleServerRequest(string(envelope.ID), raw)
+		return
 	}
 
 	s.storeAndBroadcast(raw)
 }
 
-func (s *session) storeAndBroadcast(payload []byte) {
+// maxInbound bounds how many unanswered server-to-client requests a session
+// keeps for streams opened later; the oldest are dropped beyond it.
+const maxInbound = 64
+
+// inboundTTL is how long an unanswered server-to-client request is offered
+// to new streams.
+const inboundTTL = 10 * time.Minute
+
+// serverRequest is a request issued by the transport to the client, such as
+// sampling/createMessage or roots/list, that has not been answered yet.
+type serverRequest struct {
+	id    string
+	event eventstore.Event
+	at    time.Time
+}
+
+// handleServerRequest delivers a server-to-client request to the client. A
+// request that names the progress token of a streamed call in
+// params._meta.progressToken was issued while serving that call and goes out
+// on its POST stream. Any other request goes out on the session's SSE streams
+// and is kept until answered so that a stream opened later still receives it.
+func (s *session) handleServerRequest(id string, raw []byte) {
+	var envelope struct {
+		Params json.RawMessage `json:"params"`
+	}
+	_ = json.Unmarshal(raw, &envelope)
+	if c := s.callForProgress(progressTokenOf(envelope.Params, true)); c != nil {
+		c.deliver(s.callEvent(c, raw))
+		return
+	}
+
+	ev := s.storeEvent(raw)
+
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if len(s.inbound) >= maxInbound {
+		dropped := s.inbound[0]
+		log.Printf("[mcp-proxy] DEBUG: Session %s has too many unanswered server requests, dropping %s", s.id, dropped.id)
+		s.inbound = append(s.inbound[:0], s.inbound[1:]...)
+	}
+	s.inbound = append(s.inbound, serverRequest{id: id, event: ev, at: time.Now()})
+	s.broadcast(ev)
+}
+
+// answerServerRequest records that the client answered the server request
+// with the given ID.
+func (s *session) answerServerRequest(id string) bool {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	for i, req := range s.inbound {
+		if req.id == id {
+			s.inbound = append(s.inbound[:i], s.inbound[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// markAnswers records the client's answers to server-to-client requests
+// contained in payload so they are not offered again.
+func (s *session) markAnswers(payload []byte) {
+	msgs, _, err := mcp.SplitBatch(payload)
+	if err != nil {
+		return
+	}
+	for _, raw := range msgs {
+		var resp mcp.Request
+		if json.Unmarshal(raw, &resp) == nil && resp.Method == "" && len(resp.ID) > 0 {
+			s.answerServerRequest(string(resp.ID))
+		}
+	}
+}
+
+// pruneInbound drops server requests that went unanswered for longer than
+// maxAge.
+func (s *session) pruneInbound(maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	kept := s.inbound[:0]
+	for _, req := range s.inbound {
+		if req.at.After(cutoff) {
+			kept = append(kept, req)
+		}
+	}
+	s.inbound = kept
+}
+
+func (s *session) storeEvent(payload []byte) eventstore.Event {
 	event := eventstore.Event{StreamID: s.id, Payload: payload}
-	if s.store != nil {
+	// A closed session's stream has been deleted from the store; storing
+	// into it again would leak the events.
+	if s.store != nil && s.ctx.Err() == nil {
 		event.ID = s.store.Store(s.id, payload)
 	}
+	return event
+}
+
+// callEvent records a response or progress notification for a call. Events of
+// a streamed call are stored on the stream of its POST request, so that their
+// IDs never collide with the session's GET stream.
+func (s *session) callEvent(c *call, payload []byte) eventstore.Event {
+	if c.stream == "" {
+		return eventstore.Event{StreamID: s.id, Payload: payload}
+	}
+	event := eventstore.Event{StreamID: c.stream, Payload: payload}
+	if s.ctx.Err() == nil {
+		event.ID = s.store.Store(c.stream, payload)
+	}
+	return event
+}
+
+func (s *session) storeAndBroadcast(payload []byte) eventstore.Event {
+	event := s.storeEvent(payload)
 	s.broadcast(event)
+	return event
 }
 
 func (s *session) broadcast(event eventstore.Event) {
@@ -114,6 +285,11 @@ func (s *session) broadcast(event eventstore.Event) {
 		select {
 		case ch <- event:
 		default:
+			// The subscriber fell behind. Closing its channel ends the stream so
+			// the client reconnects and resumes from its last event ID instead
+			// of silently missing events.
+			delete(s.subs, ch)
+			close(ch)
 		}
 	}
 	s.subsMu.Unlock()
@@ -131,46 +307,341 @@ func (s *session) subscribe(ch chan eventstore.Event) func() {
 	}
 }
 
+// relatedBuffer bounds how many related events may queue up for a streamed
+// dispatch before further ones are dropped.
+const relatedBuffer = 128
+
+// call tracks a client request that is waiting for its response.
+type call struct {
+	index         int
+	progressToken string
+	// results is shared by every call of one dispatch. Responses and, for
+	// streamed calls, related events travel on the same channel so that they
+	// are emitted in the order the transport produced them.
+	results  chan callResult
+	streamed bool
+	// stream is the event stream of the call's POST request, empty unless
+	// the call is streamed and the session stores events.
+	stream string
+}
+
+// callResult is either the response to the request at index or, when
+// related is set, a progress notification or server request for the call.
+type callResult struct {
+	index   int
+	related bool
+	event   eventstore.Event
+}
+
+func (c *call) respond(ev eventstore.Event) {
+	c.results <- callResult{index: c.index, event: ev}
+}
+
+func (c *call) deliver(ev eventstore.Event) {
+	// Capacity beyond relatedBuffer is reserved for responses.
+	if len(c.results) >= relatedBuffer {
+		log.Printf("[mcp-proxy] DEBUG: dropping event for a streamed call that fell behind")
+		return
+	}
+	c.results <- callResult{index: c.index, related: true, event: ev}
+}
+
+// request sends payload, a single message or a batch, to the transport and
+// returns the response. Batches produce a JSON array of responses in request
+// order. The result is nil when the payload contains no requests.
 func (s *session) request(ctx context.Context, payload []byte) ([]byte, error) {
-	var envelope map[string]json.RawMessage
-	if err := json.Unmarshal(payload, &envelope); err != nil {
+	msgs, batch, err := mcp.SplitBatch(payload)
+	if err != nil {
 		return nil, fmt.Errorf("invalid JSON: %w", err)
 	}
 
-	idRaw, hasID := envelope["id"]
-	var ch chan mcp.Message
-	if hasID {
-		ch = make(chan mcp.Message, 1)
-		s.pending.Store(string(idRaw), ch)
+	responses := make([]json.RawMessage, len(msgs))
+	count := 0
+	err = s.dispatch(ctx, msgs, nil, func(index int, ev eventstore.Event) {
+		responses[index] = ev.Payload
+		count++
+	})
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	if !batch {
+		for _, resp := range responses {
+			if resp != nil {
+				return resp, nil
+			}
+		}
+	}
+
+	collected := make([]json.RawMessage, 0, count)
+	for _, resp := range responses {
+		if resp != nil {
+			collected = append(collected, resp)
+		}
+	}
+	return json.Marshal(collected)
+}
+
+// stream sends payload to the transport and emits progress notifications and
+// server requests for its calls as they arrive, followed by each response.
+func (s *session) stream(ctx context.Context, payload []byte, emit func(eventstore.Event)) error {
+	msgs, _, err := mcp.SplitBatch(payload)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return s.dispatch(ctx, msgs, emit, func(_ int, ev eventstore.Event) {
+		emit(ev)
+	})
+}
+
+// dispatch registers every request in msgs, sends each message to the
+// transport, and waits until all responses have arrived.
+func (s *session) dispatch(ctx context.Context, msgs []json.RawMessage, related func(eventstore.Event), respond func(int, eventstore.Event)) error {
+	results := make(chan callResult, relatedBuffer+len(msgs))
+
+	var stream string
+	if related != nil && s.store != nil {
+		// The POST stream ends with the dispatch; a client that drops it
+		// cancels its calls, so its events need not outlive it.
+		stream = fmt.Sprintf("%s-post%d", s.id, s.postSeq.Add(1))
+		defer s.store.DeleteStream(stream)
+	}
+
+	var ids []string
+	release := func() {
+		for _, id := range ids {
+			s.takeCall(id)
+		}
+	}
+	cancel := func(reason string) {
+		for _, id := range ids {
+			if s.takeCall(id) != nil {
+				s.cancelCall(id, reason)
+			}
+		}
+	}
+
+	for i, raw := range msgs {
+		var req mcp.Request
+		if err := json.Unmarshal(raw, &req); err != nil {
+			release()
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		if len(req.ID) == 0 {
+			continue
+		}
+
+		if req.Method == "" {
+			// The client's answer to a server-to-client request; it is
+			// forwarded to the transport as is.
+			if !s.answerServerRequest(string(req.ID)) {
+				log.Printf("[mcp-proxy] DEBUG: forwarding response %s that matches no pending server request", req.ID)
+			}
+			continue
+		}
+
+		idKey := string(req.ID)
+		c := &call{
+			index:         i,
+			progressToken: progressTokenOf(req.Params, true),
+			results:       results,
+			streamed:      related != nil,
+			stream:        stream,
+		}
+		if !s.addCall(idKey, c) {
+			release()
+			return fmt.Errorf("duplicate request id %s", idKey)
+		}
+		ids = append(ids, idKey)
 	}
 
-	err := s.transport.Send(ctx, mcp.NewMessage(payload))
+	for _, raw := range msgs {
+		if err := s.transport.Send(ctx, mcp.NewMessage(raw)); err != nil {
+			release()
+			return err
+		}
+	}
+
+	for remaining := len(ids); remaining > 0; {
+		select {
+		case <-ctx.Done():
+			cancel(fmt.Sprintf("HTTP request ended: %v", ctx.Err()))
+			return ctx.Err()
+		case res := <-results:
+			if res.related {
+				related(res.event)
+				continue
+			}
+			remaining--
+			respond(res.index, res.event)
+		}
+	}
+
+	return nil
+}
+
+func (s *session) addCall(id string, c *call) bool {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if _, exists := s.calls[id]; exists {
+		return false
+	}
+	delete(s.cancelled, id)
+	s.calls[id] = c
+	return true
+}
+
+func (s *session) takeCall(id string) *call {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	c, ok := s.calls[id]
+	if !ok {
+		return nil
+	}
+	delete(s.calls, id)
+	return c
+}
+
+// cancelCall tells the transport that the client abandoned the request and
+// remembers the ID so a late response is dropped rather than broadcast.
+func (s *session) cancelCall(id, reason string) {
+	s.callsMu.Lock()
+	s.cancelled[id] = time.Now()
+	s.callsMu.Unlock()
+
+	payload, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "notifications/cancelled",
+		"params": map[string]any{
+			"requestId": json.RawMessage(id),
+			"reason":    reason,
+		},
+	})
 	if err != nil {
-		if hasID {
-			s.pending.Delete(string(idRaw))
+		return
+	}
+
+	log.Printf("[mcp-proxy] DEBUG: cancelling request %s: %s", id, reason)
+	if err := s.transport.Send(context.Background(), mcp.NewMessage(payload)); err != nil {
+		log.Printf("[mcp-proxy] DEBUG: failed to send cancellation for request %s: %v", id, err)
+	}
+}
+
+func (s *session) takeCancelled(id string) bool {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if _, ok := s.cancelled[id]; !ok {
+		return false
+	}
+	delete(s.cancelled, id)
+	return true
+}
+
+// pruneCancelled forgets cancelled requests the transport never answered.
+func (s *session) pruneCancelled(maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	for id, at := range s.cancelled {
+		if at.Before(cutoff) {
+			delete(s.cancelled, id)
+		}
+	}
+}
+
+func (s *session) callForProgress(token string) *call {
+	if token == "" {
+		return nil
+	}
+
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	for _, c := range s.calls {
+		if c.streamed && c.progressToken == token {
+			return c
 		}
-		return nil, err
 	}
+	return nil
+}
 
-	if !hasID {
-		return nil, nil
+// progressTokenOf extracts the progress token from request params
+// (params._meta.progressToken) or from progress notification params
+// (params.progressToken).
+func progressTokenOf(params json.RawMessage, request bool) string {
+	if len(params) == 0 {
+		return ""
 	}
 
-	select {
-	case <-ctx.Done():
-		s.pending.Delete(string(idRaw))
-		return nil, ctx.Err()
-	case msg := <-ch:
-		s.pending.Delete(string(idRaw))
-		return msg.Bytes(), nil
+	var fields struct {
+		ProgressToken json.RawMessage `json:"progressToken"`
+		Meta          struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &fields); err != nil {
+		return ""
 	}
+
+	if request {
+		return string(fields.Meta.ProgressToken)
+	}
+	return string(fields.ProgressToken)
 }
 
-func (s *session) replayAfter(lastID string, fn func(eventstore.Event)) {
+// send forwards a client message to the transport without waiting for a reply.
+func (s *session) send(ctx context.Context, payload []byte) error {
+	if !json.Valid(payload) {
+		return errors.New("invalid JSON")
+	}
+
+	return s.transport.Send(ctx, mcp.NewMessage(payload))
+}
+
+// subscribeFrom subscribes to live events and returns the stored events that
+// follow lastEventID. The subscription is taken before the store is read, so
+// an event published in between shows up in both and callers must skip live
+// events that were already replayed.
+//
+// A fresh stream (no lastEventID) starts with the server requests that are
+// still waiting for an answer.
+func (s *session) subscribeFrom(lastEventID string) (chan eventstore.Event, []eventstore.Event, func()) {
+	events := make(chan eventstore.Event, 128)
+
+	if lastEventID == "" {
+		// Holding callsMu keeps handleServerRequest from broadcasting a
+		// request that is also part of the snapshot.
+		s.callsMu.Lock()
+		unsubscribe := s.subscribe(events)
+		backlog := make([]eventstore.Event, 0, len(s.inbound))
+		for _, req := range s.inbound {
+			backlog = append(backlog, req.event)
+		}
+		s.callsMu.Unlock()
+		return events, backlog, unsubscribe
+	}
+
+	unsubscribe := s.subscribe(events)
+
+	return events, s.replayAfter(lastEventID), unsubscribe
+}
+
+func (s *session) replayAfter(lastID string) []eventstore.Event {
 	if s.store == nil {
-		return
+		return nil
+	}
+
+	var replay []eventstore.Event
+	streamID := s.store.ReplayAfter(lastID, func(ev eventstore.Event) {
+		replay = append(replay, ev)
+	})
+	if streamID != s.id {
+		// The store may be shared; never resume another session's stream.
+		return nil
 	}
-	s.store.ReplayAfter(lastID, fn)
+	return replay
 }
 
 func (s *session) run() {
@@ -185,6 +656,8 @@ func (s *session) run() {
 			if s.store != nil {
 				s.storeAndBroadcast(buildHeartbeat())
 			}
+			s.pruneCancelled(5 * time.Minute)
+			s.pruneInbound(inboundTTL)
 		}
 	}
 }
@@ -202,6 +675,19 @@ func buildErrorMessage(err error) []byte {
 	return raw
 }
 
+func buildShutdownNotice() []byte {
+	payload := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "mcp-proxy/shutdown",
+		"params": map[string]any{
+			"message": "server shutting down",
+		},
+	}
+
+	raw, _ := json.Marshal(payload)
+	return raw
+}
+
 func buildHeartbeat() []byte {
 	payload := map[string]any{
 		"jsonrpc": "2.0",
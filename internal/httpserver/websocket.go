@@ -0,0 +1,140 @@
+package httpserver
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/eventstore"
+	"github.com/sabbour/mcp-proxy-go/internal/websocket"
+)
+
+// handleWebSocket binds one WebSocket connection to a new session. Text
+// frames from the client are forwarded to the transport as JSON-RPC messages
+// and every message from the backend is pushed back as a frame. The session
+// lives exactly as long as the socket; ping/pong replaces the heartbeat
+// events used on SSE streams.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, m *mount) {
+	if r.Method != http.MethodGet || !websocket.IsUpgrade(r) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("expected WebSocket upgrade"))
+		return
+	}
+
+	sess, sessionID, err := s.createSession(r.Context(), r, m, sessionSocket)
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: Error creating MCP transport: %v", err)
+		writeSessionError(w, err)
+		return
+	}
+	closeSession := func() {
+		reason := CloseReasonClient
+		if s.draining.Load() {
+			reason = CloseReasonShutdown
+		}
+		_ = sess.close(reason)
+	}
+	defer sess.hold()()
+
+	conn, err := websocket.Accept(w, r, websocket.AcceptOptions{
+		Subprotocols:   []string{websocket.Subprotocol},
+		Header:         http.Header{"Mcp-Session-Id": {sessionID}},
+		OriginPatterns: s.opts.WebSocketOrigins,
+	})
+	if err != nil {
+		log.Printf("[mcp-proxy] DEBUG: WebSocket handshake for session %s failed: %v", sessionID, err)
+		closeSession()
+		return
+	}
+	conn.SetIdleTimeout(2 * s.opts.WebSocketPingInterval)
+
+	log.Printf("[mcp-proxy] DEBUG: WebSocket session %s established", sessionID)
+
+	events, backlog, unsubscribe := sess.subscribeFrom("")
+	defer unsubscribe()
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		s.pumpFrames(conn, sess, events, backlog)
+	}()
+
+	s.readFrames(conn, sess)
+
+	// Closing the connection fails a write blocked on a client that stopped
+	// reading, and closing the session stops the writer if the client left
+	// first.
+	_ = conn.Close(websocket.CloseNormal, "")
+	closeSession()
+	<-writerDone
+}
+
+// readFrames forwards client frames to the session until the connection
+// closes or fails.
+func (s *Server) readFrames(conn *websocket.Conn, sess *session) {
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				log.Printf("[mcp-proxy] DEBUG: WebSocket session %s read failed: %v", sess.id, err)
+			}
+			return
+		}
+		if op != websocket.OpText {
+			_ = conn.Close(websocket.CloseProtocolError, "expected text frames")
+			return
+		}
+
+		sess.touch()
+		sess.markAnswers(data)
+		if err := sess.send(sess.ctx, data); err != nil {
+			log.Printf("[mcp-proxy] DEBUG: Error forwarding message to session %s: %v", sess.id, err)
+			reply := buildErrorMessage(err)
+			if err := conn.WriteMessage(websocket.OpText, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pumpFrames writes the backlog followed by live session events as text
+// frames, pinging the client between events. It closes the connection when
+// the session ends, the subscriber falls behind, or the server shuts down.
+func (s *Server) pumpFrames(conn *websocket.Conn, sess *session, events chan eventstore.Event, backlog []eventstore.Event) {
+	for _, ev := range backlog {
+		if err := conn.WriteMessage(websocket.OpText, ev.Payload); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(s.opts.WebSocketPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sess.ctx.Done():
+			_ = conn.Close(websocket.CloseNormal, "session closed")
+			return
+		case <-s.done:
+			log.Printf("[mcp-proxy] DEBUG: Closing WebSocket for session %s on shutdown", sess.id)
+			_ = conn.WriteMessage(websocket.OpText, buildShutdownNotice())
+			_ = conn.Close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case ev, ok := <-events:
+			if !ok {
+				log.Printf("[mcp-proxy] DEBUG: WebSocket subscriber for session %s fell behind, closing", sess.id)
+				_ = conn.Close(websocket.CloseInternalError, "client fell behind")
+				return
+			}
+			if err := conn.WriteMessage(websocket.OpText, ev.Payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.Ping(nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -15,6 +15,9 @@ type Client struct {
 	requests  sync.Map
 	onClose   func()
 	seq       atomic.Uint64
+
+	mu        sync.Mutex
+	onRequest func(Message)
 }
 
 // NewClient creates a client bound to the provided transport.
@@ -22,16 +25,29 @@ func NewClient(transport Transport) *Client {
 	c := &Client{transport: transport}
 
 	transport.OnMessage(func(msg Message) {
-		var resp Response
-		if err := json.Unmarshal(msg.Bytes(), &resp); err != nil {
+		var envelope struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.Unmarshal(msg.Bytes(), &envelope); err != nil {
+			return
+		}
+
+		if envelope.Method != "" {
+			c.mu.Lock()
+			onRequest := c.onRequest
+			c.mu.Unlock()
+			if onRequest != nil {
+				onRequest(msg)
+			}
 			return
 		}
 
-		if len(resp.ID) == 0 {
+		if len(envelope.ID) == 0 {
 			return
 		}
 
-		if ch, ok := c.requests.LoadAndDelete(string(resp.ID)); ok {
+		if ch, ok := c.requests.LoadAndDelete(string(envelope.ID)); ok {
 			ch.(chan Message) <- msg
 		}
 	})
@@ -74,6 +90,9 @@ func (c *Client) Notify(ctx context.Context, method string, params any) error {
 }
 
 // Call sends a request to the remote server and returns the message response.
+// When ctx ends first the server is sent notifications/cancelled for the
+// request, with the context's cause as the reason; initialize is never
+// cancelled.
 func (c *Client) Call(ctx context.Context, method string, params any) (Message, error) {
 	id := c.seq.Add(1)
 
@@ -107,12 +126,26 @@ func (c *Client) Call(ctx context.Context, method string, params any) (Message,
 	select {
 	case <-ctx.Done():
 		c.requests.Delete(idKey)
+		if method != "initialize" {
+			_ = c.Notify(context.WithoutCancel(ctx), "notifications/cancelled", map[string]any{
+				"requestId": id,
+				"reason":    context.Cause(ctx).Error(),
+			})
+		}
 		return Message{}, ctx.Err()
 	case msg := <-ch:
 		return msg, nil
 	}
 }
 
+// OnRequest registers a callback for messages from the server that are not
+// responses to a call: notifications and server-to-client requests.
+func (c *Client) OnRequest(f func(Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRequest = f
+}
+
 // OnClose registers a callback invoked when the underlying transport closes.
 func (c *Client) OnClose(f func()) {
 	c.onClose = f
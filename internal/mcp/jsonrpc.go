@@ -1,7 +1,9 @@
 package mcp
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 )
 
 // Message represents a raw JSON-RPC message.
@@ -59,14 +61,68 @@ type Response struct {
 	Error   *ResponseError  `json:"error,omitempty"`
 }
 
-// IsInitializeRequest returns true when the raw JSON message is an initialize request.
+// SplitBatch splits a JSON-RPC payload into its individual messages. The
+// boolean result reports whether the payload was a batch array.
+func SplitBatch(raw []byte) ([]json.RawMessage, bool, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		if !json.Valid(trimmed) {
+			return nil, false, errors.New("invalid JSON")
+		}
+		return []json.RawMessage{json.RawMessage(trimmed)}, false, nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(trimmed, &batch); err != nil {
+		return nil, true, err
+	}
+	if len(batch) == 0 {
+		return nil, true, errors.New("empty batch")
+	}
+
+	return batch, true, nil
+}
+
+// IsInitializeRequest returns true when the raw JSON message is an initialize
+// request, or a batch containing one.
 func IsInitializeRequest(raw []byte) bool {
-	var req Request
-	if err := json.Unmarshal(raw, &req); err != nil {
+	msgs, _, err := SplitBatch(raw)
+	if err != nil {
+		return false
+	}
+
+	for _, msg := range msgs {
+		var req Request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			continue
+		}
+		if req.Method == "initialize" && req.JSONRPC == "2.0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasRequests returns true when the message, or any message of a batch, is a
+// request that expects a response.
+func HasRequests(raw []byte) bool {
+	msgs, _, err := SplitBatch(raw)
+	if err != nil {
 		return false
 	}
 
-	return req.Method == "initialize" && req.JSONRPC == "2.0"
+	for _, msg := range msgs {
+		var req Request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			continue
+		}
+		if req.Method != "" && len(req.ID) > 0 {
+			return true
+		}
+	}
+
+	return false
 }
 
 // IsNotification returns true when the message lacks an id field.
@@ -21,40 +21,54 @@ type Bridge struct {
 
 	leftSeq  atomic.Uint64
 	rightSeq atomic.Uint64
+
+	done     chan struct{}
+	doneOnce sync.Once
 }
 
 // NewBridge creates a new bridge between two transports.
 func NewBridge(left, right mcp.Transport) *Bridge {
-	b := &Bridge{left: left, right: right}
+	b := &Bridge{left: left, right: right, done: make(chan struct{})}
 	left.OnMessage(b.onLeftMessage)
 	right.OnMessage(b.onRightMessage)
 
 	left.OnError(func(err error) { right.Send(context.Background(), mcp.NewMessage(buildErrorNotification("left", err))) })
 	right.OnError(func(err error) { left.Send(context.Background(), mcp.NewMessage(buildErrorNotification("right", err))) })
 
-	left.OnClose(func() { right.Close() })
-	right.OnClose(func() { left.Close() })
+	left.OnClose(func() {
+		right.Close()
+		b.finish()
+	})
+	right.OnClose(func() {
+		left.Close()
+		b.finish()
+	})
 
 	return b
 }
 
+// Start starts the right transport and then the left one. The right side is
+// usually the server, and transports such as SSE or WebSocket clients must
+// connect before they can take the messages the left side forwards as soon
+// as it starts reading. The left side is not started when the right one
+// fails, and the right one is closed when the left one fails.
 func (b *Bridge) Start(ctx context.Context) error {
 	var errLeft, errRight error
 	b.startedOnce.Do(func() {
-		errLeft = b.left.Start(ctx)
-		if errLeft != nil {
-			return
-		}
 		errRight = b.right.Start(ctx)
 		if errRight != nil {
-			_ = b.left.Close()
+			return
+		}
+		errLeft = b.left.Start(ctx)
+		if errLeft != nil {
+			_ = b.right.Close()
 		}
 	})
 
-	if errLeft != nil {
-		return errLeft
+	if errRight != nil {
+		return errRight
 	}
-	return errRight
+	return errLeft
 }
 
 func (b *Bridge) Close() error {
@@ -63,6 +77,15 @@ func (b *Bridge) Close() error {
 	return nil
 }
 
+// Done is closed once either transport has closed.
+func (b *Bridge) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *Bridge) finish() {
+	b.doneOnce.Do(func() { close(b.done) })
+}
+
 func (b *Bridge) onLeftMessage(msg mcp.Message) {
 	b.forward(msg, b.left, b.right, &b.leftSeq, &b.leftMap, &b.rightMap)
 }
@@ -0,0 +1,844 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+var (
+	errMuxUnavailable = errors.New("no shared backend available")
+	errConnClosed     = errors.New("shared connection closed")
+	errNoRequestOwner = errors.New("cannot tell which session the request is for")
+)
+
+// Mux serves many sessions from a fixed set of long-lived backend transports.
+// Request IDs and progress tokens are namespaced per backend so that replies
+// reach the session that sent the request. The first initialize handshake is
+// forwarded to the backend and its result is replayed to every later session.
+// Resource updates and log messages only reach the sessions that subscribed
+// to them.
+type Mux struct {
+	mu       sync.Mutex
+	backends []*backend
+	retired  []*backend // replaced by Recycle, closed once drained
+}
+
+// NewMux creates a multiplexer over the given backend transports.
+func NewMux(transports ...mcp.Transport) *Mux {
+	return &Mux{backends: newBackends(transports)}
+}
+
+func newBackends(transports []mcp.Transport) []*backend {
+	backends := make([]*backend, 0, len(transports))
+	for _, transport := range transports {
+		b := &backend{
+			transport: transport,
+			conns:     map[*MuxConn]struct{}{},
+			pending:   map[string]pendingCall{},
+			tokens:    map[string]pendingToken{},
+			discard:   map[string]struct{}{},
+		}
+		transport.OnMessage(b.receive)
+		transport.OnError(b.reportError)
+		transport.OnClose(b.shutdown)
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// Start starts every backend transport.
+func (m *Mux) Start(ctx context.Context) error {
+	m.mu.Lock()
+	backends := m.backends
+	m.mu.Unlock()
+	return startBackends(ctx, backends)
+}
+
+func startBackends(ctx context.Context, backends []*backend) error {
+	for i, b := range backends {
+		if err := b.transport.Start(ctx); err != nil {
+			for _, started := range backends[:i] {
+				_ = started.transport.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Recycle starts transports and attaches new connections to them from now
+// on, for instance after the server's command changed. Connections already
+// attached stay on their backend, which is closed once the last of them
+// detaches. If a new transport fails to start, the started ones are closed
+// and the current backends are kept.
+func (m *Mux) Recycle(ctx context.Context, transports ...mcp.Transport) error {
+	fresh := newBackends(transports)
+	if err := startBackends(ctx, fresh); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	old := m.backends
+	m.backends = fresh
+	m.retired = append(m.retired, old...)
+	m.mu.Unlock()
+
+	for _, b := range old {
+		b.mu.Lock()
+		b.draining = true
+		idle := len(b.conns) == 0 && !b.closed
+		b.mu.Unlock()
+		if idle {
+			_ = b.transport.Close()
+		}
+	}
+	return nil
+}
+
+// Close closes every backend transport, which in turn closes all attached
+// connections.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	backends := append(append([]*backend(nil), m.backends...), m.retired...)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, b := range backends {
+		if err := b.transport.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Attach returns a new connection bound to the live backend with the fewest
+// attached connections.
+func (m *Mux) Attach() (*MuxConn, error) {
+	m.mu.Lock()
+	backends := m.backends
+	m.mu.Unlock()
+
+	var target *backend
+	least := -1
+	for _, b := range backends {
+		b.mu.Lock()
+		closed, load := b.closed, len(b.conns)
+		b.mu.Unlock()
+		if closed {
+			continue
+		}
+		if least < 0 || load < least {
+			target, least = b, load
+		}
+	}
+	if target == nil {
+		return nil, errMuxUnavailable
+	}
+
+	c := &MuxConn{backend: target, calls: map[string]string{}, subs: map[string]struct{}{}}
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	if target.closed || target.draining {
+		return nil, errMuxUnavailable
+	}
+	target.conns[c] = struct{}{}
+	return c, nil
+}
+
+// pendingCall remembers who sent a request forwarded under a proxy ID.
+type pendingCall struct {
+	conn  *MuxConn
+	id    json.RawMessage
+	token string // proxy progress token, if the request carried one
+}
+
+// pendingToken maps a proxy progress token back to the caller's token.
+type pendingToken struct {
+	conn  *MuxConn
+	token json.RawMessage
+}
+
+type backend struct {
+	transport mcp.Transport
+	seq       atomic.Uint64
+
+	mu          sync.Mutex
+	conns       map[*MuxConn]struct{}
+	pending     map[string]pendingCall  // proxy request id -> caller
+	tokens      map[string]pendingToken // proxy progress token -> caller
+	discard     map[string]struct{}     // ids of requests the mux sent on its own behalf
+	initResult  json.RawMessage         // cached initialize result
+	initID      string                  // proxy id of the initialize in flight
+	initWaiters []pendingCall
+	initialized bool
+	closed      bool
+	draining    bool // replaced by Recycle; closes when the last conn detaches
+}
+
+func (b *backend) nextID() string {
+	return fmt.Sprintf(`"mux-%d"`, b.seq.Add(1))
+}
+
+// send handles one message from an attached connection.
+func (b *backend) send(ctx context.Context, c *MuxConn, raw []byte) error {
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return fmt.Errorf("invalid JSON-RPC message: %w", err)
+	}
+
+	var method string
+	_ = json.Unmarshal(env["method"], &method)
+	id, hasID := env["id"]
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errMuxUnavailable
+	}
+
+	switch {
+	case method == "initialize" && hasID:
+		return b.initialize(ctx, c, env, id)
+
+	case method == "notifications/initialized":
+		if b.initialized {
+			b.mu.Unlock()
+			return nil
+		}
+		b.initialized = true
+
+	case method == "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		_ = json.Unmarshal(env["params"], &params)
+		proxyID, ok := c.calls[string(params.RequestID)]
+		if !ok {
+			b.mu.Unlock()
+			return nil
+		}
+		rewritten, err := setField(env["params"], "requestId", json.RawMessage(proxyID))
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		env["params"] = rewritten
+
+	case method != "" && hasID:
+		handled, err := b.track(c, method, env, id)
+		if handled || err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		proxyID := b.nextID()
+		call := pendingCall{conn: c, id: id}
+		if token := progressTokenOf(env["params"]); token != nil {
+			call.token = b.nextID()
+			rewritten, err := setProgressToken(env["params"], json.RawMessage(call.token))
+			if err != nil {
+				b.mu.Unlock()
+				return err
+			}
+			env["params"] = rewritten
+			b.tokens[call.token] = pendingToken{conn: c, token: token}
+		}
+		env["id"] = json.RawMessage(proxyID)
+		b.pending[proxyID] = call
+		c.calls[string(id)] = proxyID
+	}
+	b.mu.Unlock()
+
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return b.transport.Send(ctx, mcp.NewMessage(payload))
+}
+
+// track records the resource subscriptions and log level of a connection. It
+// reports whether the request was answered without the backend, which is the
+// case when other connections still need an unsubscribed resource. It is
+// called with b.mu held.
+func (b *backend) track(c *MuxConn, method string, env map[string]json.RawMessage, id json.RawMessage) (bool, error) {
+	var params struct {
+		URI   string `json:"uri"`
+		Level string `json:"level"`
+	}
+	_ = json.Unmarshal(env["params"], &params)
+
+	switch method {
+	case "resources/subscribe":
+		c.subs[params.URI] = struct{}{}
+
+	case "resources/unsubscribe":
+		delete(c.subs, params.URI)
+		if b.subscribed(params.URI) {
+			go c.deliver(buildResult(id, json.RawMessage("{}")))
+			return true, nil
+		}
+
+	case "logging/setLevel":
+		// The backend has a single level, so it logs at the most verbose
+		// level any connection asked for and each connection gets the
+		// messages at or above its own.
+		c.logLevel = params.Level
+		rewritten, err := setField(env["params"], "level", mustMarshal(b.logLevel()))
+		if err != nil {
+			return false, err
+		}
+		env["params"] = rewritten
+	}
+	return false, nil
+}
+
+// subscribed reports whether any connection is subscribed to uri. It is
+// called with b.mu held.
+func (b *backend) subscribed(uri string) bool {
+	for c := range b.conns {
+		if _, ok := c.subs[uri]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// logLevel returns the most verbose level set by a connection. It is called
+// with b.mu held.
+func (b *backend) logLevel() string {
+	level := ""
+	for c := range b.conns {
+		if c.logLevel != "" && (level == "" || severity(c.logLevel) < severity(level)) {
+			level = c.logLevel
+		}
+	}
+	return level
+}
+
+// initialize answers from the cached result when the backend has already been
+// initialized, and otherwise forwards a single initialize on behalf of every
+// connection waiting for one. It is called with b.mu held.
+func (b *backend) initialize(ctx context.Context, c *MuxConn, env map[string]json.RawMessage, id json.RawMessage) error {
+	if b.initResult != nil {
+		result := b.initResult
+		b.mu.Unlock()
+		go c.deliver(buildResult(id, result))
+		return nil
+	}
+
+	b.initWaiters = append(b.initWaiters, pendingCall{conn: c, id: id})
+	if b.initID != "" {
+		b.mu.Unlock()
+		return nil
+	}
+	b.initID = b.nextID()
+	env["id"] = json.RawMessage(b.initID)
+	b.mu.Unlock()
+
+	payload, err := json.Marshal(env)
+	if err == nil {
+		err = b.transport.Send(ctx, mcp.NewMessage(payload))
+	}
+	if err != nil {
+		b.mu.Lock()
+		b.initID = ""
+		waiters := b.initWaiters
+		b.initWaiters = nil
+		b.mu.Unlock()
+		for _, w := range waiters {
+			if w.conn != c {
+				w.conn.deliver(buildError(w.id, err))
+			}
+		}
+	}
+	return err
+}
+
+// receive routes a message from the backend to the connection it belongs to,
+// or to every connection when it is not tied to a request.
+func (b *backend) receive(msg mcp.Message) {
+	raw := msg.Bytes()
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &env); err != nil {
+		b.broadcast(raw)
+		return
+	}
+
+	var method string
+	_ = json.Unmarshal(env["method"], &method)
+	id, hasID := env["id"]
+
+	switch {
+	case method == "" && hasID:
+		b.receiveResponse(env, id)
+
+	case method == "notifications/progress":
+		var params struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		}
+		_ = json.Unmarshal(env["params"], &params)
+		b.mu.Lock()
+		owner, ok := b.tokens[string(params.ProgressToken)]
+		b.mu.Unlock()
+		if !ok {
+			return
+		}
+		owner.conn.deliverField(env, "progressToken", owner.token)
+
+	case method == "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		_ = json.Unmarshal(env["params"], &params)
+		b.mu.Lock()
+		call, ok := b.takePending(string(params.RequestID))
+		b.mu.Unlock()
+		if !ok {
+			return
+		}
+		call.conn.deliverField(env, "requestId", call.id)
+
+	case method == "notifications/resources/updated":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		_ = json.Unmarshal(env["params"], &params)
+		b.deliverTo(raw, func(c *MuxConn) bool {
+			_, ok := c.subs[params.URI]
+			return ok
+		})
+
+	case method == "notifications/message":
+		var params struct {
+			Level string `json:"level"`
+		}
+		_ = json.Unmarshal(env["params"], &params)
+		b.deliverTo(raw, func(c *MuxConn) bool {
+			return c.logLevel != "" && severity(params.Level) >= severity(c.logLevel)
+		})
+
+	case hasID:
+		b.receiveRequest(env, id)
+
+	default:
+		b.broadcast(raw)
+	}
+}
+
+// receiveRequest routes a server-to-client request to the session whose call
+// it serves: the caller of the request named by its progress token, else the
+// only session with requests in flight, else the only session attached. A
+// request whose session cannot be told is refused. The answer is forwarded
+// unchanged since backend IDs are unique.
+func (b *backend) receiveRequest(env map[string]json.RawMessage, id json.RawMessage) {
+	b.mu.Lock()
+	var target *MuxConn
+	var token json.RawMessage
+	if owner, ok := b.tokens[string(progressTokenOf(env["params"]))]; ok {
+		target, token = owner.conn, owner.token
+	} else {
+		var busy []*MuxConn
+		for c := range b.conns {
+			if len(c.calls) > 0 {
+				busy = append(busy, c)
+			}
+		}
+		switch {
+		case len(busy) == 1:
+			target = busy[0]
+		case len(busy) == 0 && len(b.conns) == 1:
+			for c := range b.conns {
+				target = c
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	if target == nil {
+		log.Printf("[mcp-proxy] DEBUG: refusing shared server request %s: %v", id, errNoRequestOwner)
+		if err := b.transport.Send(context.Background(), mcp.NewMessage(buildError(id, errNoRequestOwner))); err != nil {
+			log.Printf("[mcp-proxy] DEBUG: failed to refuse shared server request %s: %v", id, err)
+		}
+		return
+	}
+
+	if token != nil {
+		params, err := setProgressToken(env["params"], token)
+		if err != nil {
+			return
+		}
+		env["params"] = params
+	}
+	if payload, err := json.Marshal(env); err == nil {
+		target.deliver(payload)
+	}
+}
+
+func (b *backend) receiveResponse(env map[string]json.RawMessage, id json.RawMessage) {
+	key := string(id)
+
+	b.mu.Lock()
+	if b.initID != "" && key == b.initID {
+		b.initID = ""
+		waiters := b.initWaiters
+		b.initWaiters = nil
+		if _, failed := env["error"]; !failed {
+			b.initResult = env["result"]
+		}
+		b.mu.Unlock()
+
+		for _, w := range waiters {
+			env["id"] = w.id
+			if payload, err := json.Marshal(env); err == nil {
+				w.conn.deliver(payload)
+			}
+		}
+		return
+	}
+
+	if _, ok := b.discard[key]; ok {
+		delete(b.discard, key)
+		b.mu.Unlock()
+		return
+	}
+	call, ok := b.takePending(key)
+	b.mu.Unlock()
+	if !ok {
+		log.Printf("[mcp-proxy] DEBUG: dropping response for unknown shared request %s", key)
+		return
+	}
+
+	env["id"] = call.id
+	if payload, err := json.Marshal(env); err == nil {
+		call.conn.deliver(payload)
+	}
+}
+
+// takePending removes and returns the caller of a forwarded request. It is
+// called with b.mu held.
+func (b *backend) takePending(proxyID string) (pendingCall, bool) {
+	call, ok := b.pending[proxyID]
+	if !ok {
+		return pendingCall{}, false
+	}
+	delete(b.pending, proxyID)
+	delete(call.conn.calls, string(call.id))
+	if call.token != "" {
+		delete(b.tokens, call.token)
+	}
+	return call, true
+}
+
+func (b *backend) broadcast(raw []byte) {
+	b.deliverTo(raw, func(*MuxConn) bool { return true })
+}
+
+// deliverTo delivers raw to the connections accepted by match, which is
+// called with b.mu held.
+func (b *backend) deliverTo(raw []byte, match func(*MuxConn) bool) {
+	b.mu.Lock()
+	conns := make([]*MuxConn, 0, len(b.conns))
+	for c := range b.conns {
+		if match(c) {
+			conns = append(conns, c)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, c := range conns {
+		c.deliver(raw)
+	}
+}
+
+func (b *backend) reportError(err error) {
+	b.mu.Lock()
+	conns := make([]*MuxConn, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+
+	for _, c := range conns {
+		c.reportError(err)
+	}
+}
+
+// shutdown runs when the backend transport closes and closes every attached
+// connection.
+func (b *backend) shutdown() {
+	b.mu.Lock()
+	b.closed = true
+	conns := make([]*MuxConn, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+
+	for _, c := range conns {
+		c.detach(false)
+	}
+}
+
+// MuxConn is one session's view of a shared backend. It implements
+// mcp.Transport.
+type MuxConn struct {
+	backend *backend
+	// Guarded by backend.mu.
+	calls    map[string]string   // caller request id -> proxy id
+	subs     map[string]struct{} // subscribed resource URIs
+	logLevel string              // level set by logging/setLevel, empty if none
+
+	mu        sync.Mutex
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+	closed    bool
+	closeOnce sync.Once
+}
+
+// Start fails when the backend is gone; the backend itself is started by Mux.
+func (c *MuxConn) Start(ctx context.Context) error {
+	c.backend.mu.Lock()
+	defer c.backend.mu.Unlock()
+	if c.backend.closed {
+		return errMuxUnavailable
+	}
+	return nil
+}
+
+// Send forwards the message, or each message of a batch, to the backend.
+func (c *MuxConn) Send(ctx context.Context, msg mcp.Message) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return errConnClosed
+	}
+
+	msgs, _, err := mcp.SplitBatch(msg.Bytes())
+	if err != nil {
+		return err
+	}
+	for _, raw := range msgs {
+		if err := c.backend.send(ctx, c, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close detaches the connection and cancels its outstanding requests on the
+// backend. The backend keeps running.
+func (c *MuxConn) Close() error {
+	c.detach(true)
+	return nil
+}
+
+// OnMessage registers a callback for inbound messages.
+func (c *MuxConn) OnMessage(fn func(mcp.Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onMessage = fn
+}
+
+// OnError registers a callback for backend errors.
+func (c *MuxConn) OnError(fn func(error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onError = fn
+}
+
+// OnClose registers a callback invoked when the connection is closed or the
+// backend exits.
+func (c *MuxConn) OnClose(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onClose = fn
+}
+
+func (c *MuxConn) detach(cancel bool) {
+	c.closeOnce.Do(func() {
+		b := c.backend
+		b.mu.Lock()
+		delete(b.conns, c)
+		drained := b.draining && !b.closed && len(b.conns) == 0
+		abandoned := make([]string, 0, len(c.calls))
+		for _, proxyID := range c.calls {
+			if _, ok := b.takePending(proxyID); ok {
+				abandoned = append(abandoned, proxyID)
+			}
+		}
+		// Resources nobody else watches are unsubscribed on the backend.
+		var unsubscribe [][]byte
+		if cancel {
+			for uri := range c.subs {
+				if !b.subscribed(uri) {
+					id := b.nextID()
+					b.discard[id] = struct{}{}
+					unsubscribe = append(unsubscribe, buildUnsubscribe(json.RawMessage(id), uri))
+				}
+			}
+		}
+		b.mu.Unlock()
+
+		for _, payload := range unsubscribe {
+			if err := b.transport.Send(context.Background(), mcp.NewMessage(payload)); err != nil {
+				log.Printf("[mcp-proxy] DEBUG: failed to unsubscribe shared resource: %v", err)
+			}
+		}
+
+		if cancel {
+			for _, proxyID := range abandoned {
+				payload := buildCancelled(json.RawMessage(proxyID), "session closed")
+				if err := b.transport.Send(context.Background(), mcp.NewMessage(payload)); err != nil {
+					log.Printf("[mcp-proxy] DEBUG: failed to cancel shared request %s: %v", proxyID, err)
+				}
+			}
+		}
+
+		if drained {
+			if err := b.transport.Close(); err != nil {
+				log.Printf("[mcp-proxy] DEBUG: failed to close drained shared backend: %v", err)
+			}
+		}
+
+		c.mu.Lock()
+		c.closed = true
+		onClose := c.onClose
+		c.mu.Unlock()
+		if onClose != nil {
+			onClose()
+		}
+	})
+}
+
+func (c *MuxConn) deliver(raw []byte) {
+	c.mu.Lock()
+	onMessage, closed := c.onMessage, c.closed
+	c.mu.Unlock()
+	if onMessage != nil && !closed {
+		onMessage(mcp.NewMessage(raw))
+	}
+}
+
+// deliverField rewrites one params field of a notification before delivering it.
+func (c *MuxConn) deliverField(env map[string]json.RawMessage, key string, value json.RawMessage) {
+	params, err := setField(env["params"], key, value)
+	if err != nil {
+		return
+	}
+	env["params"] = params
+	if payload, err := json.Marshal(env); err == nil {
+		c.deliver(payload)
+	}
+}
+
+func (c *MuxConn) reportError(err error) {
+	c.mu.Lock()
+	onError := c.onError
+	c.mu.Unlock()
+	if onError != nil {
+		onError(err)
+	}
+}
+
+func progressTokenOf(params json.RawMessage) json.RawMessage {
+	var p struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil
+	}
+	return p.Meta.ProgressToken
+}
+
+func setProgressToken(params json.RawMessage, token json.RawMessage) (json.RawMessage, error) {
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	meta, err := setField(p["_meta"], "progressToken", token)
+	if err != nil {
+		return nil, err
+	}
+	p["_meta"] = meta
+	return json.Marshal(p)
+}
+
+func setField(obj json.RawMessage, key string, value json.RawMessage) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if len(obj) > 0 {
+		if err := json.Unmarshal(obj, &fields); err != nil {
+			return nil, err
+		}
+	}
+	fields[key] = value
+	return json.Marshal(fields)
+}
+
+func buildResult(id json.RawMessage, result json.RawMessage) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+	return raw
+}
+
+func buildError(id json.RawMessage, err error) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]any{
+			"code":    -32603,
+			"message": err.Error(),
+		},
+	})
+	return raw
+}
+
+func buildUnsubscribe(id json.RawMessage, uri string) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  "resources/unsubscribe",
+		"params":  map[string]any{"uri": uri},
+	})
+	return raw
+}
+
+func buildCancelled(requestID json.RawMessage, reason string) []byte {
+	raw, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "notifications/cancelled",
+		"params": map[string]any{
+			"requestId": requestID,
+			"reason":    reason,
+		},
+	})
+	return raw
+}
+
+func mustMarshal(v any) json.RawMessage {
+	raw, _ := json.Marshal(v)
+	return raw
+}
+
+// severity orders the MCP log levels from debug (0) to emergency (7).
+// Unknown levels rank as the most severe so that they are never filtered.
+func severity(level string) int {
+	for i, name := range []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"} {
+		if level == name {
+			return i
+		}
+	}
+	return 7
+}
@@ -0,0 +1,128 @@
+// Package registry records which proxy replica owns each session, so that a
+// replica receiving a request for a session it does not hold can forward it
+// to the owner.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Registry maps session IDs to the base URL of the replica that owns them.
+type Registry interface {
+	// Register records owner as the replica holding the session.
+	Register(sessionID, owner string) error
+	// Lookup returns the owner of a session, or "" when it is unknown.
+	Lookup(sessionID string) (string, error)
+	// Unregister forgets the session.
+	Unregister(sessionID string) error
+}
+
+// File is a Registry kept in a directory shared by the replicas, such as a
+// volume mounted into every container. Each session is a file named after its
+// ID that holds the owner's URL.
+type File struct {
+	dir string
+}
+
+var _ Registry = (*File)(nil)
+
+// NewFile creates the registry directory if needed.
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+// Register writes the session's file. The file is replaced atomically, so a
+// concurrent Lookup sees either no owner or the whole URL.
+func (f *File) Register(sessionID, owner string) error {
+	path, err := f.path(sessionID)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.dir, ".register-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(owner); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Lookup reads the session's file.
+func (f *File) Lookup(sessionID string) (string, error) {
+	path, err := f.path(sessionID)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Unregister removes the session's file.
+func (f *File) Unregister(sessionID string) error {
+	path, err := f.path(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// RemoveOwner unregisters every session owned by owner. A replica calls it on
+// startup to drop the sessions a previous run of it left behind when it
+// crashed.
+func (f *File) RemoveOwner(owner string) (int, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(f.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != owner {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// path returns the file of a session. Session IDs come from clients, so
+// anything that could leave the directory is rejected.
+func (f *File) path(sessionID string) (string, error) {
+	if sessionID == "" || strings.HasPrefix(sessionID, ".") || strings.ContainsAny(sessionID, `/\`) {
+		return "", fmt.Errorf("invalid session id %q", sessionID)
+	}
+	return filepath.Join(f.dir, sessionID), nil
+}
@@ -10,30 +10,47 @@ import (
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 
 	"github.com/sabbour/mcp-proxy-go/internal/jsonfilter"
 	"github.com/sabbour/mcp-proxy-go/internal/mcp"
 )
 
+// defaultTerminateTimeout is used when Params.TerminateTimeout is zero.
+const defaultTerminateTimeout = 5 * time.Second
+
 // Params configures the stdio client transport.
 type Params struct {
 	Command string
 	Args    []string
 	Dir     string
 	Env     []string
+	// TerminateTimeout is how long Close waits after SIGTERM before sending
+	// SIGKILL to the process group.
+	TerminateTimeout time.Duration
+}
+
+// ExitStatus describes how the server process ended.
+type ExitStatus struct {
+	PID    int
+	Code   int    // exit code, or -1 when the process was killed by a signal
+	Signal string // terminating signal, if any
+	Err    error  // error returned by Wait, if any
 }
 
 type Client struct {
-	params     Params
-	cmd        *exec.Cmd
-	stdin      io.WriteCloser
-	stdout     io.ReadCloser
-	stderr     io.ReadCloser
-	mu         sync.Mutex
-	onMessage  func(mcp.Message)
-	onError    func(error)
-	onClose    func()
-	closedOnce sync.Once
+	params    Params
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	stderr    io.ReadCloser
+	mu        sync.Mutex
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+	onExit    func(ExitStatus)
+	closed    bool
+	exited    chan struct{} // closed once the process has been reaped
 }
 
 // NewClient creates a new stdio client transport.
@@ -62,11 +79,23 @@ func (c *Client) OnClose(fn func()) {
 	c.onClose = fn
 }
 
+// OnExit registers a callback invoked with the exit status once the process
+// has been reaped.
+func (c *Client) OnExit(fn func(ExitStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onExit = fn
+}
+
 // Start launches the underlying process and begins reading stdout.
 func (c *Client) Start(ctx context.Context) error {
 	log.Printf("[mcp-proxy] DEBUG: Starting stdio client with command: %s %v", c.params.Command, c.params.Args)
-	
+
 	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errors.New("client closed")
+	}
 	if c.cmd != nil {
 		c.mu.Unlock()
 		return errors.New("already started")
@@ -82,6 +111,14 @@ func (c *Client) Start(ctx context.Context) error {
 		log.Printf("[mcp-proxy] DEBUG: Added environment variables: %v", c.params.Env)
 	}
 
+	// Run the server in its own process group so that termination reaches
+	// grandchildren started by launchers such as npx, uvx or go run.
+	configureProcess(cmd)
+	cmd.Cancel = func() error {
+		return terminateProcess(cmd.Process)
+	}
+	cmd.WaitDelay = c.terminateTimeout()
+
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		log.Printf("[mcp-proxy] DEBUG: Error creating stdin pipe: %v", err)
@@ -103,16 +140,23 @@ func (c *Client) Start(ctx context.Context) error {
 		return err
 	}
 
+	exited := make(chan struct{})
+
 	c.cmd = cmd
 	c.stdin = stdin
 	c.stdout = stdout
 	c.stderr = stderr
-	c.mu.Unlock()
+	c.exited = exited
 
+	// The lock is held until the process runs so that a concurrent Close
+	// either prevents the start or terminates the started process.
 	if err := cmd.Start(); err != nil {
+		c.mu.Unlock()
 		log.Printf("[mcp-proxy] DEBUG: Error starting command: %v", err)
+		close(exited)
 		return err
 	}
+	c.mu.Unlock()
 
 	log.Printf("[mcp-proxy] DEBUG: Command started successfully with PID: %d", cmd.Process.Pid)
 
@@ -121,6 +165,8 @@ func (c *Client) Start(ctx context.Context) error {
 	go func() {
 		err := cmd.Wait()
 		log.Printf("[mcp-proxy] DEBUG: Command finished with error: %v", err)
+		c.reportExit(cmd, err)
+		close(exited)
 		c.close()
 	}()
 
@@ -169,6 +215,21 @@ func (c *Client) readStderr() {
 	}
 }
 
+func (c *Client) reportExit(cmd *exec.Cmd, err error) {
+	status := ExitStatus{PID: cmd.Process.Pid, Code: -1, Err: err}
+	if state := cmd.ProcessState; state != nil {
+		status.Code = state.ExitCode()
+		status.Signal = exitSignal(state)
+	}
+
+	c.mu.Lock()
+	onExit := c.onExit
+	c.mu.Unlock()
+	if onExit != nil {
+		onExit(status)
+	}
+}
+
 func (c *Client) reportError(err error) {
 	c.mu.Lock()
 	onError := c.onError
@@ -181,7 +242,7 @@ func (c *Client) reportError(err error) {
 // Send writes the JSON message to stdin.
 func (c *Client) Send(ctx context.Context, msg mcp.Message) error {
 	log.Printf("[mcp-proxy] DEBUG: Sending message: %s", string(msg.Bytes()))
-	
+
 	c.mu.Lock()
 	stdin := c.stdin
 	c.mu.Unlock()
@@ -203,33 +264,79 @@ func (c *Client) Send(ctx context.Context, msg mcp.Message) error {
 	return err
 }
 
-// Close terminates the process.
+// Close terminates the process and waits for it to exit. Stdin is closed
+// first, then the process group receives SIGTERM and, if it is still running
+// after TerminateTimeout, SIGKILL.
 func (c *Client) Close() error {
+	c.mu.Lock()
+	exited := c.exited
+	c.mu.Unlock()
+
 	c.close()
+
+	if exited != nil {
+		<-exited
+	}
 	return nil
 }
 
+// close runs once. A flag rather than sync.Once guards it because onClose may
+// close a peer transport that in turn closes this one again.
 func (c *Client) close() {
-	c.closedOnce.Do(func() {
-		c.mu.Lock()
-		onClose := c.onClose
-		stdin := c.stdin
-		cmd := c.cmd
-		c.stdin = nil
-		c.cmd = nil
+	c.mu.Lock()
+	if c.closed {
 		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	onClose := c.onClose
+	stdin := c.stdin
+	cmd := c.cmd
+	exited := c.exited
+	c.stdin = nil
+	c.cmd = nil
+	c.mu.Unlock()
 
-		if stdin != nil {
-			_ = stdin.Close()
-		}
-		if cmd != nil && cmd.Process != nil {
-			_ = cmd.Process.Kill()
-		}
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	if cmd != nil && cmd.Process != nil {
+		c.terminate(cmd.Process, exited)
+	}
+
+	if onClose != nil {
+		onClose()
+	}
+}
+
+func (c *Client) terminate(process *os.Process, exited chan struct{}) {
+	_ = terminateProcess(process)
 
-		if onClose != nil {
-			onClose()
+	timeout := c.terminateTimeout()
+	deadline := time.Now().Add(timeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+		// Other members of the group may ignore SIGTERM and outlive the
+		// leader. They are killed at the deadline without holding up Close.
+		if groupAlive(process) {
+			time.AfterFunc(time.Until(deadline), func() {
+				_ = killProcess(process)
+			})
 		}
-	})
+	case <-timer.C:
+		log.Printf("[mcp-proxy] DEBUG: Process %d did not exit after SIGTERM, killing process group", process.Pid)
+		_ = killProcess(process)
+	}
+}
+
+func (c *Client) terminateTimeout() time.Duration {
+	if c.params.TerminateTimeout > 0 {
+		return c.params.TerminateTimeout
+	}
+	return defaultTerminateTimeout
 }
 
 // Helper to trim trailing whitespace while keeping JSON intact.
@@ -0,0 +1,556 @@
+package stdio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// warmRetryDelay throttles the filler after a process failed to start.
+const warmRetryDelay = time.Second
+
+var (
+	// ErrPoolExhausted is returned by Get when MaxProcesses are running.
+	ErrPoolExhausted = errors.New("process limit reached")
+	errPoolClosed    = errors.New("pool closed")
+)
+
+// PoolOptions configures a Pool.
+type PoolOptions struct {
+	// Size is the number of started processes kept ready for new sessions.
+	Size int
+	// MaxProcesses caps warm and in-use processes together. Zero means
+	// unlimited.
+	MaxProcesses int
+	// Initialize performs the initialize handshake while a process is warm,
+	// with the params of the most recent client initialize. A client whose
+	// initialize params are the same is answered from the cached result;
+	// any other client gets a freshly started process instead. Until the
+	// first client initializes, warm processes are handed out
+	// uninitialized.
+	Initialize bool
+	// InitializeTimeout bounds the warm handshake. Defaults to 30s.
+	InitializeTimeout time.Duration
+}
+
+// PoolStats is a snapshot of pool counters.
+type PoolStats struct {
+	Hits        uint64 // sessions served by a warm process
+	Misses      uint64 // sessions that had to start a process
+	Initialized uint64 // sessions answered from a warm initialize handshake
+	Warm        int    // processes ready in the pool
+	Running     int    // warm, starting and in-use processes
+}
+
+// Pool keeps started server processes ready so new sessions skip the process
+// start and, optionally, the initialize handshake.
+type Pool struct {
+	newTransport func() mcp.Transport
+	opts         PoolOptions
+
+	mu      sync.Mutex
+	warm    []*pooled
+	warming int
+	running int
+	closed  bool
+	// generation changes on Flush; processes that were warming before are
+	// discarded when they are ready.
+	generation int
+	// initParams are the params of the latest client initialize, which
+	// warm processes are initialized with.
+	initParams json.RawMessage
+
+	wake chan struct{}
+	done chan struct{}
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	initialized atomic.Uint64
+}
+
+// NewPool creates a pool of transports built by newTransport, typically a
+// *Client or *Supervisor. Call Start to begin filling it.
+func NewPool(newTransport func() mcp.Transport, opts PoolOptions) *Pool {
+	if opts.InitializeTimeout <= 0 {
+		opts.InitializeTimeout = reinitializeTimeout
+	}
+	return &Pool{
+		newTransport: newTransport,
+		opts:         opts,
+		wake:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start launches the background filler.
+func (p *Pool) Start() {
+	go p.fill()
+	p.signal()
+}
+
+// Get hands out a warm transport, or a fresh unstarted one when the pool is
+// empty. The caller owns the transport and must Start and Close it as usual.
+func (p *Pool) Get(ctx context.Context) (mcp.Transport, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+
+	if len(p.warm) > 0 {
+		t := p.warm[0]
+		p.warm = p.warm[1:]
+		t.claimed.Store(true)
+		p.mu.Unlock()
+		p.hits.Add(1)
+		p.signal()
+		return t, nil
+	}
+
+	if p.opts.MaxProcesses > 0 && p.running >= p.opts.MaxProcesses {
+		p.mu.Unlock()
+		return nil, ErrPoolExhausted
+	}
+	p.running++
+	p.mu.Unlock()
+
+	p.misses.Add(1)
+	p.signal()
+
+	t := p.wrap(p.newTransport())
+	t.claimed.Store(true)
+	return t, nil
+}
+
+// Stats returns the current pool counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Hits:        p.hits.Load(),
+		Misses:      p.misses.Load(),
+		Initialized: p.initialized.Load(),
+		Warm:        len(p.warm),
+		Running:     p.running,
+	}
+}
+
+// Close stops the filler and closes the warm processes. Transports already
+// handed out are left to their owners.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	warm := p.warm
+	p.warm = nil
+	p.mu.Unlock()
+	close(p.done)
+
+	var errs []error
+	for _, t := range warm {
+		if err := t.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush closes the warm processes and discards the ones still starting, so
+// the pool refills with transports built by newTransport from now on, for
+// instance after the server's command changed. Transports already handed
+// out are left to their owners.
+func (p *Pool) Flush() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errPoolClosed
+	}
+	p.generation++
+	warm := p.warm
+	p.warm = nil
+	p.mu.Unlock()
+
+	var errs []error
+	for _, t := range warm {
+		if err := t.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.release()
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// fill starts processes until Size are warm or MaxProcesses are running.
+func (p *Pool) fill() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.wake:
+		}
+
+		p.mu.Lock()
+		for !p.closed && len(p.warm)+p.warming < p.opts.Size &&
+			(p.opts.MaxProcesses == 0 || p.running < p.opts.MaxProcesses) {
+			p.warming++
+			p.running++
+			go p.warmOne(p.generation)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *Pool) warmOne(generation int) {
+	t := p.wrap(p.newTransport())
+	err := t.current().Start(context.Background())
+	if err == nil {
+		t.started = true
+		if params := p.clientParams(); p.opts.Initialize && params != nil {
+			err = t.preinitialize(params, p.opts.InitializeTimeout)
+		}
+	}
+
+	p.mu.Lock()
+	p.warming--
+	if err != nil || p.closed || t.gone.Load() || generation != p.generation {
+		p.mu.Unlock()
+		if err != nil {
+			log.Printf("[mcp-proxy] ERROR: failed to warm server process: %v", err)
+		}
+		_ = t.Close()
+		t.release()
+		if err != nil {
+			// Give a broken command a moment before the filler retries.
+			time.AfterFunc(warmRetryDelay, p.signal)
+		}
+		return
+	}
+	p.warm = append(p.warm, t)
+	p.mu.Unlock()
+}
+
+// release accounts for a process that exited or failed to start.
+func (p *Pool) release(t *pooled) {
+	p.mu.Lock()
+	p.running--
+	for i, w := range p.warm {
+		if w == t {
+			p.warm = append(p.warm[:i], p.warm[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	p.signal()
+}
+
+// learn records the params of a client initialize for the processes warmed
+// from now on.
+func (p *Pool) learn(params json.RawMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.initParams = params
+}
+
+func (p *Pool) clientParams() json.RawMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.initParams
+}
+
+func (p *Pool) wrap(inner mcp.Transport) *pooled {
+	t := &pooled{pool: p, inner: inner}
+	t.attach(inner)
+	return t
+}
+
+// pooled wraps a pool transport so the pool can track its lifetime and answer
+// the client's initialize from a handshake performed while it was warm.
+type pooled struct {
+	pool    *Pool
+	started bool
+
+	claimed     atomic.Bool // handed out by Get
+	gone        atomic.Bool // process exited
+	releaseOnce sync.Once
+
+	mu         sync.Mutex
+	inner      mcp.Transport
+	initID     string
+	initReply  chan mcp.Message
+	initResult json.RawMessage
+	initParams json.RawMessage // params the warm handshake was made with
+
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+}
+
+func (t *pooled) Start(ctx context.Context) error {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	if err := t.current().Start(ctx); err != nil {
+		t.release()
+		return err
+	}
+	return nil
+}
+
+func (t *pooled) Send(ctx context.Context, msg mcp.Message) error {
+	t.mu.Lock()
+	inner, result, warmParams := t.inner, t.initResult, t.initParams
+	t.mu.Unlock()
+
+	var req mcp.Request
+	if err := json.Unmarshal(msg.Bytes(), &req); err == nil {
+		switch req.Method {
+		case "initialize":
+			params := canonicalJSON(req.Params)
+			if t.pool.opts.Initialize {
+				t.pool.learn(params)
+			}
+			if result != nil {
+				if bytes.Equal(params, warmParams) {
+					t.pool.initialized.Add(1)
+					go t.deliverInitialize(req.ID, result)
+					return nil
+				}
+				// The warm handshake announced other capabilities or
+				// another protocol version than this client's.
+				fresh, err := t.replace()
+				if err != nil {
+					return err
+				}
+				inner = fresh
+			}
+		case "notifications/initialized":
+			if result != nil {
+				// Already sent during the warm handshake.
+				return nil
+			}
+		}
+	}
+
+	return inner.Send(ctx, msg)
+}
+
+func (t *pooled) Close() error {
+	return t.current().Close()
+}
+
+// current returns the process the transport runs on.
+func (t *pooled) current() mcp.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inner
+}
+
+// attach routes the callbacks of inner to t for as long as it is the current
+// process.
+func (t *pooled) attach(inner mcp.Transport) {
+	inner.OnMessage(func(msg mcp.Message) {
+		if t.current() == inner {
+			t.receive(msg)
+		}
+	})
+	inner.OnError(func(err error) {
+		if t.current() == inner {
+			t.reportError(err)
+		}
+	})
+	inner.OnClose(func() {
+		if t.current() == inner {
+			t.handleClose()
+		}
+	})
+}
+
+// replace closes the warm process and starts a fresh one in its place, which
+// counts as a miss rather than a hit. The process count is unchanged.
+func (t *pooled) replace() (mcp.Transport, error) {
+	fresh := t.pool.newTransport()
+	t.attach(fresh)
+
+	t.mu.Lock()
+	old := t.inner
+	t.inner = fresh
+	t.initResult, t.initParams = nil, nil
+	t.mu.Unlock()
+
+	t.pool.hits.Add(^uint64(0))
+	t.pool.misses.Add(1)
+	_ = old.Close()
+
+	// The process outlives the request that triggered the replacement.
+	if err := fresh.Start(context.Background()); err != nil {
+		t.release()
+		return nil, err
+	}
+	return fresh, nil
+}
+
+func (t *pooled) OnMessage(fn func(mcp.Message)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onMessage = fn
+}
+
+func (t *pooled) OnError(fn func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onError = fn
+}
+
+func (t *pooled) OnClose(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onClose = fn
+}
+
+// preinitialize performs the initialize handshake on a warm process with the
+// given client params.
+func (t *pooled) preinitialize(params json.RawMessage, timeout time.Duration) error {
+	t.mu.Lock()
+	t.initID = fmt.Sprintf(`"mcp-proxy-warm-%d"`, time.Now().UnixNano())
+	t.initReply = make(chan mcp.Message, 1)
+	initID, reply := t.initID, t.initReply
+	t.mu.Unlock()
+
+	raw, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      json.RawMessage(initID),
+		"method":  "initialize",
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	if err := t.current().Send(context.Background(), mcp.NewMessage(raw)); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var resp mcp.Response
+	select {
+	case msg := <-reply:
+		if err := json.Unmarshal(msg.Bytes(), &resp); err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("initialize failed: %s", resp.Error.Message)
+		}
+	case <-timer.C:
+		return errors.New("timed out waiting for initialize response")
+	}
+
+	initialized := []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if err := t.current().Send(context.Background(), mcp.NewMessage(initialized)); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.initResult, t.initParams = resp.Result, params
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *pooled) deliverInitialize(id json.RawMessage, result json.RawMessage) {
+	raw, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+	if err != nil {
+		return
+	}
+	t.deliver(mcp.NewMessage(raw))
+}
+
+func (t *pooled) receive(msg mcp.Message) {
+	t.mu.Lock()
+	if t.initID != "" {
+		var resp mcp.Response
+		if err := json.Unmarshal(msg.Bytes(), &resp); err == nil && string(resp.ID) == t.initID {
+			reply := t.initReply
+			t.initID = ""
+			t.mu.Unlock()
+			reply <- msg
+			return
+		}
+	}
+	t.mu.Unlock()
+
+	// Messages sent while warm have no session to go to yet.
+	if t.claimed.Load() {
+		t.deliver(msg)
+	}
+}
+
+func (t *pooled) deliver(msg mcp.Message) {
+	t.mu.Lock()
+	onMessage := t.onMessage
+	t.mu.Unlock()
+	if onMessage != nil {
+		onMessage(msg)
+	}
+}
+
+func (t *pooled) reportError(err error) {
+	t.mu.Lock()
+	onError := t.onError
+	t.mu.Unlock()
+	if onError != nil {
+		onError(err)
+	}
+}
+
+func (t *pooled) handleClose() {
+	t.gone.Store(true)
+	t.release()
+
+	t.mu.Lock()
+	onClose := t.onClose
+	t.mu.Unlock()
+	if onClose != nil {
+		onClose()
+	}
+}
+
+func (t *pooled) release() {
+	t.releaseOnce.Do(func() { t.pool.release(t) })
+}
+
+// canonicalJSON re-encodes raw with sorted object keys so that equal params
+// compare equal byte for byte. Invalid JSON is returned unchanged.
+func canonicalJSON(raw json.RawMessage) json.RawMessage {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package stdio
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func configureProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcess asks the whole process group to exit.
+func terminateProcess(process *os.Process) error {
+	if process == nil {
+		return nil
+	}
+	return syscall.Kill(-process.Pid, syscall.SIGTERM)
+}
+
+// killProcess forcibly kills the whole process group.
+func killProcess(process *os.Process) error {
+	if process == nil {
+		return nil
+	}
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
+
+// groupAlive reports whether any process of the group is still running.
+func groupAlive(process *os.Process) bool {
+	return process != nil && syscall.Kill(-process.Pid, 0) == nil
+}
+
+func exitSignal(state *os.ProcessState) string {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal().String()
+	}
+	return ""
+}
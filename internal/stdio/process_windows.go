@@ -0,0 +1,37 @@
+//go:build windows
+
+package stdio
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Windows has no process groups or signals comparable to POSIX, so the
+// direct child is killed outright.
+
+func configureProcess(cmd *exec.Cmd) {}
+
+func terminateProcess(process *os.Process) error {
+	if process == nil {
+		return nil
+	}
+	return process.Kill()
+}
+
+func killProcess(process *os.Process) error {
+	if process == nil {
+		return nil
+	}
+	return process.Kill()
+}
+
+// groupAlive reports false: processes are not grouped on Windows and
+// killProcess only reaches the child itself.
+func groupAlive(*os.Process) bool {
+	return false
+}
+
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,144 @@
+package stdio
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+var errServerClosed = errors.New("stdio server transport closed")
+
+// ServerTransport speaks newline-delimited JSON-RPC over a reader and writer,
+// typically the proxy's own stdin and stdout, so that a local MCP client can
+// launch the proxy as its stdio server.
+type ServerTransport struct {
+	in     io.Reader
+	out    io.Writer
+	closer io.Closer
+
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+	closed    bool
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+}
+
+// NewServerTransport creates a transport reading messages from in and writing
+// them to out.
+func NewServerTransport(in io.Reader, out io.Writer) *ServerTransport {
+	return &ServerTransport{in: in, out: out}
+}
+
+// NewConnTransport creates a transport speaking the same newline-delimited
+// framing over a connection such as a unix socket. Unlike stdin and stdout,
+// the connection is closed together with the transport.
+func NewConnTransport(conn io.ReadWriteCloser) *ServerTransport {
+	return &ServerTransport{in: conn, out: conn, closer: conn}
+}
+
+// OnMessage registers a callback for inbound messages.
+func (s *ServerTransport) OnMessage(fn func(mcp.Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onMessage = fn
+}
+
+// OnError registers a callback for read errors.
+func (s *ServerTransport) OnError(fn func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = fn
+}
+
+// OnClose registers a callback invoked when the input reaches EOF or the
+// transport is closed.
+func (s *ServerTransport) OnClose(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClose = fn
+}
+
+// Start begins reading messages from the input.
+func (s *ServerTransport) Start(ctx context.Context) error {
+	go s.read()
+	return nil
+}
+
+func (s *ServerTransport) read() {
+	defer s.Close()
+
+	reader := bufio.NewReader(s.in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if trimmed := bytesTrim(line); len(trimmed) > 0 {
+			s.mu.Lock()
+			onMessage, closed := s.onMessage, s.closed
+			s.mu.Unlock()
+			if closed {
+				return
+			}
+			if onMessage != nil {
+				onMessage(mcp.NewMessage(trimmed))
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.reportError(err)
+			}
+			return
+		}
+	}
+}
+
+func (s *ServerTransport) reportError(err error) {
+	s.mu.Lock()
+	onError, closed := s.onError, s.closed
+	s.mu.Unlock()
+	if onError != nil && !closed {
+		onError(err)
+	}
+}
+
+// Send writes the message followed by a newline to the output.
+func (s *ServerTransport) Send(ctx context.Context, msg mcp.Message) error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return errServerClosed
+	}
+
+	data := append(msg.Bytes(), '\n')
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err := s.out.Write(data)
+	return err
+}
+
+// Close stops delivering messages. The underlying reader is left open since
+// it is usually the process's stdin, unless the transport owns a connection.
+func (s *ServerTransport) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	onClose := s.onClose
+	s.mu.Unlock()
+
+	var err error
+	if s.closer != nil {
+		err = s.closer.Close()
+	}
+	if onClose != nil {
+		onClose()
+	}
+	return err
+}
@@ -0,0 +1,472 @@
+package stdio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// reinitializeTimeout bounds how long a restarted process may take to answer
+// the replayed initialize request.
+const reinitializeTimeout = 30 * time.Second
+
+// errSupervisorClosed is returned by Send once the supervisor gave up or was closed.
+var errSupervisorClosed = errors.New("supervisor closed")
+
+// SupervisorOptions configures how a Supervisor restarts its process.
+type SupervisorOptions struct {
+	// InitialBackoff is the delay before the first restart; it doubles with
+	// every further restart inside RestartWindow. Defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the restart delay. Defaults to 30s.
+	MaxBackoff time.Duration
+	// MaxRestarts is how many restarts are allowed within RestartWindow
+	// before the supervisor gives up and closes. Defaults to 5.
+	MaxRestarts int
+	// RestartWindow is the period over which restarts are counted. Defaults
+	// to one minute.
+	RestartWindow time.Duration
+}
+
+func (o SupervisorOptions) withDefaults() SupervisorOptions {
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = 500 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	if o.MaxRestarts <= 0 {
+		o.MaxRestarts = 5
+	}
+	if o.RestartWindow <= 0 {
+		o.RestartWindow = time.Minute
+	}
+	return o
+}
+
+// Supervisor is a transport that runs a stdio server and restarts it with
+// exponential backoff when the process exits unexpectedly. Requests in flight
+// when the process dies fail with a JSON-RPC error, and the cached initialize
+// handshake is replayed to every new process so the peer can carry on with
+// the same session.
+type Supervisor struct {
+	params Params
+	opts   SupervisorOptions
+
+	mu          sync.Mutex
+	client      *Client
+	ready       chan struct{} // closed while a process is accepting messages
+	stopped     chan struct{} // closed once the supervisor gave up or was closed
+	closing     bool
+	inflight    map[string]struct{} // request ids awaiting a response
+	initRequest *mcp.Request
+	initialized []byte
+	reinitID    string
+	reinit      chan mcp.Message
+	restarts    []time.Time
+	stopOnce    sync.Once
+
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+	onExit    func(ExitStatus)
+}
+
+// NewSupervisor creates a supervisor for the process described by params.
+func NewSupervisor(params Params, opts SupervisorOptions) *Supervisor {
+	return &Supervisor{
+		params:   params,
+		opts:     opts.withDefaults(),
+		ready:    make(chan struct{}),
+		stopped:  make(chan struct{}),
+		inflight: map[string]struct{}{},
+	}
+}
+
+// OnMessage registers a callback for inbound messages.
+func (s *Supervisor) OnMessage(fn func(mcp.Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onMessage = fn
+}
+
+// OnError registers a callback for transport errors.
+func (s *Supervisor) OnError(fn func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = fn
+}
+
+// OnClose registers a callback invoked when the supervisor is closed or gives
+// up restarting the process.
+func (s *Supervisor) OnClose(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClose = fn
+}
+
+// OnExit registers a callback invoked with the exit status of every process
+// the supervisor runs.
+func (s *Supervisor) OnExit(fn func(ExitStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExit = fn
+}
+
+// Start launches the first process.
+func (s *Supervisor) Start(ctx context.Context) error {
+	client, err := s.spawn()
+	if err != nil {
+		return err
+	}
+
+	s.markReady(client)
+	return nil
+}
+
+// Send forwards the message to the current process, waiting while a restart
+// is in progress.
+func (s *Supervisor) Send(ctx context.Context, msg mcp.Message) error {
+	var req mcp.Request
+	_ = json.Unmarshal(msg.Bytes(), &req)
+
+	s.mu.Lock()
+	ready, stopped := s.ready, s.stopped
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+	case <-stopped:
+		return errSupervisorClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	client := s.client
+	switch {
+	case req.Method == "initialize":
+		cached := req
+		s.initRequest = &cached
+	case req.Method == "notifications/initialized":
+		s.initialized = msg.Bytes()
+	}
+	tracked := req.Method != "" && len(req.ID) > 0
+	if tracked {
+		s.inflight[string(req.ID)] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	if client == nil {
+		return errSupervisorClosed
+	}
+	err := client.Send(ctx, msg)
+	if err != nil && tracked {
+		// A request fails once: either the caller gets the error or, when
+		// the process exit was handled first, the error response.
+		s.mu.Lock()
+		_, pending := s.inflight[string(req.ID)]
+		delete(s.inflight, string(req.ID))
+		s.mu.Unlock()
+		if !pending {
+			return nil
+		}
+	}
+	return err
+}
+
+// Close stops the current process without restarting it.
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	s.closing = true
+	client := s.client
+	s.mu.Unlock()
+
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+
+	s.stop()
+	return err
+}
+
+// spawn starts a new process and makes it the current one.
+func (s *Supervisor) spawn() (*Client, error) {
+	client := NewClient(s.params)
+	client.OnMessage(func(msg mcp.Message) { s.handleMessage(client, msg) })
+	client.OnError(func(err error) {
+		s.mu.Lock()
+		onError := s.onError
+		s.mu.Unlock()
+		if onError != nil {
+			onError(err)
+		}
+	})
+	client.OnExit(func(status ExitStatus) {
+		s.mu.Lock()
+		onExit := s.onExit
+		s.mu.Unlock()
+		if onExit != nil {
+			onExit(status)
+		}
+	})
+	client.OnClose(func() { s.handleExit(client) })
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return nil, errSupervisorClosed
+	}
+	s.client = client
+	s.mu.Unlock()
+
+	err := client.Start(context.Background())
+
+	// Close may have run while the process was starting and missed it.
+	s.mu.Lock()
+	closing := s.closing
+	s.mu.Unlock()
+	if closing {
+		_ = client.Close()
+		return nil, errSupervisorClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (s *Supervisor) handleMessage(client *Client, msg mcp.Message) {
+	var resp mcp.Response
+	var method struct {
+		Method string `json:"method"`
+	}
+	raw := msg.Bytes()
+	_ = json.Unmarshal(raw, &resp)
+	_ = json.Unmarshal(raw, &method)
+
+	s.mu.Lock()
+	if client != s.client {
+		s.mu.Unlock()
+		return
+	}
+	if method.Method == "" && len(resp.ID) > 0 {
+		id := string(resp.ID)
+		if s.reinitID != "" && id == s.reinitID {
+			reinit := s.reinit
+			s.reinitID = ""
+			s.mu.Unlock()
+			reinit <- msg
+			return
+		}
+		delete(s.inflight, id)
+	}
+	onMessage := s.onMessage
+	s.mu.Unlock()
+
+	if onMessage != nil {
+		onMessage(msg)
+	}
+}
+
+// handleExit runs when a process closes. Unless the supervisor is closing,
+// in-flight requests are failed and a restart is scheduled.
+func (s *Supervisor) handleExit(client *Client) {
+	s.mu.Lock()
+	if client != s.client {
+		s.mu.Unlock()
+		return
+	}
+
+	if s.closing {
+		s.mu.Unlock()
+		s.stop()
+		return
+	}
+
+	select {
+	case <-s.ready:
+		s.ready = make(chan struct{})
+	default:
+	}
+
+	inflight := s.inflight
+	s.inflight = map[string]struct{}{}
+
+	now := time.Now()
+	recent := s.restarts[:0]
+	for _, at := range s.restarts {
+		if now.Sub(at) < s.opts.RestartWindow {
+			recent = append(recent, at)
+		}
+	}
+	s.restarts = recent
+
+	giveUp := len(s.restarts) >= s.opts.MaxRestarts
+	if !giveUp {
+		s.restarts = append(s.restarts, now)
+	}
+	attempt := len(s.restarts)
+	s.mu.Unlock()
+
+	s.failInflight(inflight)
+
+	if giveUp {
+		log.Printf("[mcp-proxy] ERROR: stdio server crashed %d times within %s, giving up", attempt, s.opts.RestartWindow)
+		s.stop()
+		return
+	}
+
+	go s.restart(attempt)
+}
+
+func (s *Supervisor) restart(attempt int) {
+	delay := s.backoff(attempt)
+	log.Printf("[mcp-proxy] INFO: restarting stdio server in %s (attempt %d)", delay, attempt)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.stopped:
+		return
+	}
+
+	client, err := s.spawn()
+	if errors.Is(err, errSupervisorClosed) {
+		return
+	}
+	if err != nil {
+		log.Printf("[mcp-proxy] ERROR: failed to restart stdio server: %v", err)
+		s.mu.Lock()
+		failed := s.client
+		s.mu.Unlock()
+		s.handleExit(failed)
+		return
+	}
+
+	if err := s.reinitialize(client); err != nil {
+		// Closing the process schedules the next attempt through handleExit.
+		log.Printf("[mcp-proxy] ERROR: failed to reinitialize stdio server: %v", err)
+		_ = client.Close()
+		return
+	}
+
+	s.markReady(client)
+}
+
+// markReady lets Send through to client if it is still the current process.
+func (s *Supervisor) markReady(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != client || s.closing {
+		return
+	}
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
+	}
+}
+
+// reinitialize replays the cached initialize handshake to a new process. The
+// response is consumed here since the peer already received one.
+func (s *Supervisor) reinitialize(client *Client) error {
+	s.mu.Lock()
+	initRequest := s.initRequest
+	initialized := s.initialized
+	if initRequest == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.reinitID = fmt.Sprintf(`"mcp-proxy-reinit-%d"`, time.Now().UnixNano())
+	s.reinit = make(chan mcp.Message, 1)
+	reinitID, reinit := s.reinitID, s.reinit
+	s.mu.Unlock()
+
+	replay := *initRequest
+	replay.ID = json.RawMessage(reinitID)
+	raw, err := json.Marshal(replay)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Send(context.Background(), mcp.NewMessage(raw)); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(reinitializeTimeout)
+	defer timer.Stop()
+
+	select {
+	case msg := <-reinit:
+		if err := mcp.AwaitResult(msg, nil); err != nil {
+			return err
+		}
+	case <-timer.C:
+		return errors.New("timed out waiting for initialize response")
+	case <-s.stopped:
+		return errSupervisorClosed
+	}
+
+	if initialized != nil {
+		return client.Send(context.Background(), mcp.NewMessage(initialized))
+	}
+	return nil
+}
+
+func (s *Supervisor) backoff(attempt int) time.Duration {
+	delay := s.opts.InitialBackoff
+	for i := 1; i < attempt && delay < s.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.MaxBackoff {
+		delay = s.opts.MaxBackoff
+	}
+	return delay
+}
+
+// failInflight answers every in-flight request with a JSON-RPC error.
+func (s *Supervisor) failInflight(inflight map[string]struct{}) {
+	s.mu.Lock()
+	onMessage := s.onMessage
+	s.mu.Unlock()
+	if onMessage == nil {
+		return
+	}
+
+	for id := range inflight {
+		payload, err := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      json.RawMessage(id),
+			"error": map[string]any{
+				"code":    -32603,
+				"message": "MCP server process exited; request aborted",
+			},
+		})
+		if err != nil {
+			continue
+		}
+		onMessage(mcp.NewMessage(payload))
+	}
+}
+
+func (s *Supervisor) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+
+		s.mu.Lock()
+		onClose := s.onClose
+		s.mu.Unlock()
+		if onClose != nil {
+			onClose()
+		}
+	})
+}
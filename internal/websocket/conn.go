@@ -0,0 +1,301 @@
+// Package websocket implements the subset of RFC 6455 needed to carry
+// JSON-RPC messages: the opening handshake for servers and clients, text and
+// binary messages with fragmentation, and ping, pong and close control frames.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Opcodes defined by RFC 6455.
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close status codes used by this package.
+const (
+	CloseNormal         = 1000
+	CloseGoingAway      = 1001
+	CloseProtocolError  = 1002
+	CloseMessageTooBig  = 1009
+	CloseInternalError  = 1011
+	closeNoStatus       = 1005
+	defaultMaxMessage   = 16 << 20
+	maxControlFrameSize = 125
+
+	defaultWriteTimeout = 10 * time.Second
+	closeWriteTimeout   = time.Second
+)
+
+var errProtocol = errors.New("websocket: protocol error")
+
+// CloseError is returned by ReadMessage when the peer closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with status %d %s", e.Code, e.Reason)
+}
+
+// Conn is a WebSocket connection. ReadMessage must be called from a single
+// goroutine; writes may be issued concurrently.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	client      bool // clients mask outgoing frames and expect unmasked ones
+	subprotocol string
+
+	// MaxMessageSize limits the size of a reassembled message. Defaults to
+	// 16 MiB.
+	MaxMessageSize int64
+	// WriteTimeout bounds each frame write, so a peer that stops reading
+	// cannot block a writer forever. Defaults to 10s; zero disables it.
+	WriteTimeout time.Duration
+
+	idleTimeout time.Duration
+	writeMu     sync.Mutex
+	closeMu     sync.Mutex
+	closeSent   bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool, subprotocol string) *Conn {
+	return &Conn{
+		conn:           conn,
+		br:             br,
+		client:         client,
+		subprotocol:    subprotocol,
+		MaxMessageSize: defaultMaxMessage,
+		WriteTimeout:   defaultWriteTimeout,
+	}
+}
+
+// Subprotocol returns the negotiated subprotocol, if any.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// SetIdleTimeout makes reads fail when no frame, including a pong, arrives
+// for d. Combined with periodic pings this detects dead peers.
+func (c *Conn) SetIdleTimeout(d time.Duration) {
+	c.idleTimeout = d
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs are consumed transparently. When the peer closes the connection
+// the close is acknowledged and a *CloseError is returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+
+	for {
+		if c.idleTimeout > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
+
+		fin, op, payload, err := c.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			closeErr := &CloseError{Code: closeNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			_ = c.Close(closeErr.Code, "")
+			return 0, nil, closeErr
+		case OpText, OpBinary:
+			if opcode != 0 {
+				return 0, nil, c.fail(errProtocol)
+			}
+			opcode = op
+		case OpContinuation:
+			if opcode == 0 {
+				return 0, nil, c.fail(errProtocol)
+			}
+		default:
+			return 0, nil, c.fail(errProtocol)
+		}
+
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads one frame; buffered is the size of the message assembled so
+// far, used to enforce MaxMessageSize.
+func (c *Conn) readFrame(buffered int64) (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	op := int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(errProtocol)
+	}
+
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		// Clients must mask, servers must not.
+		return false, 0, nil, c.fail(errProtocol)
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if op >= OpClose && (length > maxControlFrameSize || !fin) {
+		return false, 0, nil, c.fail(errProtocol)
+	}
+	if length < 0 || (op < OpClose && buffered+length > c.MaxMessageSize) {
+		_ = c.Close(CloseMessageTooBig, "message too big")
+		return false, 0, nil, errors.New("websocket: message too big")
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends data as a single text or binary frame.
+func (c *Conn) WriteMessage(op int, data []byte) error {
+	return c.writeFrame(op, data)
+}
+
+// Ping sends a ping control frame.
+func (c *Conn) Ping(data []byte) error {
+	return c.writeFrame(OpPing, data)
+}
+
+func (c *Conn) writeFrame(op int, data []byte) error {
+	return c.writeFrameWithin(op, data, c.WriteTimeout)
+}
+
+func (c *Conn) writeFrameWithin(op int, data []byte, timeout time.Duration) error {
+	frame := make([]byte, 0, len(data)+14)
+	frame = append(frame, 0x80|byte(op))
+
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(data) < 126:
+		frame = append(frame, maskBit|byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(data)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(data)))
+	}
+
+	if c.client {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, data...)
+		maskBytes(key, frame[start:])
+	} else {
+		frame = append(frame, data...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if timeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame with the given status, unless one was already
+// sent, and closes the underlying connection.
+func (c *Conn) Close(code int, reason string) error {
+	c.closeMu.Lock()
+	sent := c.closeSent
+	c.closeSent = true
+	c.closeMu.Unlock()
+
+	if !sent {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		if len(reason) > maxControlFrameSize-2 {
+			reason = reason[:maxControlFrameSize-2]
+		}
+		payload = append(payload, reason...)
+		// The deadline also unblocks a writer stuck on a peer that stopped
+		// reading, which would otherwise hold writeMu.
+		_ = c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+		_ = c.writeFrameWithin(OpClose, payload, closeWriteTimeout)
+	}
+	return c.conn.Close()
+}
+
+func (c *Conn) fail(err error) error {
+	_ = c.Close(CloseProtocolError, "")
+	return err
+}
+
+func maskBytes(key [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= key[i%4]
+	}
+}
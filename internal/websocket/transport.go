@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+// Subprotocol is offered and accepted for MCP over WebSocket.
+const Subprotocol = "mcp"
+
+// DefaultPingInterval is how often an idle connection is pinged. A peer that
+// sends nothing, not even a pong, for two intervals is considered dead.
+const DefaultPingInterval = 30 * time.Second
+
+var errNotConnected = errors.New("websocket: not connected")
+
+// TransportOptions configures a client Transport.
+type TransportOptions struct {
+	URL          string
+	Header       http.Header
+	PingInterval time.Duration
+}
+
+// Transport is an mcp.Transport that exchanges JSON-RPC messages as text
+// frames over one WebSocket connection.
+type Transport struct {
+	opts TransportOptions
+
+	mu        sync.Mutex
+	conn      *Conn
+	sessionID string
+	closed    bool
+	done      chan struct{}
+	onMessage func(mcp.Message)
+	onError   func(error)
+	onClose   func()
+}
+
+// NewTransport creates a client transport for the given endpoint.
+func NewTransport(opts TransportOptions) *Transport {
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = DefaultPingInterval
+	}
+	return &Transport{opts: opts, done: make(chan struct{})}
+}
+
+// OnMessage registers a callback for inbound messages.
+func (t *Transport) OnMessage(fn func(mcp.Message)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onMessage = fn
+}
+
+// OnError registers a callback for transport errors.
+func (t *Transport) OnError(fn func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onError = fn
+}
+
+// OnClose registers a callback invoked when the connection ends.
+func (t *Transport) OnClose(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onClose = fn
+}
+
+// SessionID returns the session ID announced by the server, if any.
+func (t *Transport) SessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// Start dials the server and begins reading messages.
+func (t *Transport) Start(ctx context.Context) error {
+	conn, resp, err := Dial(ctx, t.opts.URL, DialOptions{
+		Header:       t.opts.Header,
+		Subprotocols: []string{Subprotocol},
+	})
+	if err != nil {
+		return err
+	}
+	conn.SetIdleTimeout(2 * t.opts.PingInterval)
+
+	t.mu.Lock()
+	t.conn = conn
+	t.sessionID = resp.Header.Get("mcp-session-id")
+	t.mu.Unlock()
+
+	go t.read(conn)
+	go t.ping(conn)
+	return nil
+}
+
+// Send writes the message as a text frame.
+func (t *Transport) Send(ctx context.Context, msg mcp.Message) error {
+	t.mu.Lock()
+	conn, closed := t.conn, t.closed
+	t.mu.Unlock()
+	if conn == nil || closed {
+		return errNotConnected
+	}
+	return conn.WriteMessage(OpText, msg.Bytes())
+}
+
+// Close sends a normal close frame and ends the connection.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	conn := t.conn
+	onClose := t.onClose
+	close(t.done)
+	t.mu.Unlock()
+
+	var err error
+	if conn != nil {
+		err = conn.Close(CloseNormal, "")
+	}
+	if onClose != nil {
+		onClose()
+	}
+	return err
+}
+
+func (t *Transport) read(conn *Conn) {
+	defer t.Close()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *CloseError
+			if !errors.As(err, &closeErr) {
+				t.mu.Lock()
+				closed, onError := t.closed, t.onError
+				t.mu.Unlock()
+				if !closed && onError != nil {
+					onError(err)
+				}
+			}
+			return
+		}
+
+		t.mu.Lock()
+		onMessage := t.onMessage
+		t.mu.Unlock()
+		if onMessage != nil {
+			onMessage(mcp.NewMessage(data))
+		}
+	}
+}
+
+func (t *Transport) ping(conn *Conn) {
+	ticker := time.NewTicker(t.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if err := conn.Ping(nil); err != nil {
+				log.Printf("[mcp-proxy] DEBUG: WebSocket ping failed: %v", err)
+				return
+			}
+		}
+	}
+}
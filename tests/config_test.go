@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sabbour/mcp-proxy-go/internal/config"
+)
+
+func TestConfigLoad(t *testing.T) {
+	writeFile := func(t *testing.T, dir, name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("expands environment and secrets", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("PROXY_PORT", "4100")
+		t.Setenv("GITHUB_TOKEN", "gh-token")
+		writeFile(t, dir, "fs.key", "fs-secret\n")
+		path := writeFile(t, dir, "proxy.yaml", `
+listeners:
+  - port: ${PROXY_PORT}
+  - host: 127.0.0.1
+    port: 4101
+auth:
+  apiKey: ${PROXY_KEY:-default-key}
+limits:
+  maxSessions: 10
+  sessionIdleTimeout: 10m
+server:
+  command: node
+  args: ["server.js", "--tags=a,b"]
+servers:
+  fs:
+    command: mcp-fs
+    apiKey: file:fs.key
+    stateless: true
+    env:
+      TOKEN: "${GITHUB_TOKEN}"
+`)
+
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+		require.Equal(t, []config.Listener{{Port: 4100}, {Host: "127.0.0.1", Port: 4101}}, cfg.Listeners)
+		require.Equal(t, "default-key", cfg.Auth.APIKey)
+		require.Equal(t, 10, cfg.Limits.MaxSessions)
+		require.Equal(t, 10*time.Minute, cfg.Limits.SessionIdleTimeout)
+		require.Equal(t, []string{"server.js", "--tags=a,b"}, cfg.Server.Args)
+
+		fs := cfg.Servers["fs"]
+		require.Equal(t, "fs-secret", fs.APIKey)
+		require.True(t, fs.Stateless)
+		require.Equal(t, []string{"TOKEN=gh-token"}, fs.EnvList())
+	})
+
+	t.Run("imports client configs", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "claude_desktop_config.json", "{\n\t\"mcpServers\": {\n\t\t\"github\": {\"command\": \"npx\", \"args\": [\"-y\", \"server-github\"]},\n\t\t\"fs\": {\"command\": \"npx\"}\n\t}\n}")
+		writeFile(t, dir, "mcp.json", `{"servers": {"remote": {"type": "http", "url": "https://example.com/mcp"}, "local": {"type": "stdio", "command": "local-server"}}}`)
+		path := writeFile(t, dir, "proxy.yaml", `
+import:
+  - claude_desktop_config.json
+  - mcp.json
+servers:
+  fs:
+    command: mcp-fs
+`)
+
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+		require.Len(t, cfg.Servers, 3)
+		require.Equal(t, []string{"-y", "server-github"}, cfg.Servers["github"].Args)
+		require.Equal(t, "mcp-fs", cfg.Servers["fs"].Command)
+		require.Equal(t, "local-server", cfg.Servers["local"].Command)
+
+		// A Claude Desktop config can also be loaded directly.
+		cfg, err = config.Load(filepath.Join(dir, "claude_desktop_config.json"))
+		require.NoError(t, err)
+		require.Len(t, cfg.Servers, 2)
+	})
+
+	t.Run("skips servers with VS Code variables", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("GITHUB_TOKEN", "gh-token")
+		path := writeFile(t, dir, "mcp.json", `{
+	"inputs": [{"type": "promptString", "id": "api-key", "password": true}],
+	"servers": {
+		"prompted": {"command": "npx", "args": ["server"], "env": {"API_KEY": "${input:api-key}"}},
+		"workspace": {"command": "npx", "args": ["${workspaceFolder}/server.js"]},
+		"github": {"command": "npx", "env": {"TOKEN": "${env:GITHUB_TOKEN}"}}
+	}
+}`)
+
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+		require.Len(t, cfg.Servers, 1)
+		require.Equal(t, []string{"TOKEN=gh-token"}, cfg.Servers["github"].EnvList())
+
+		path = writeFile(t, dir, "proxy.yaml", "server:\n  command: node\n  args: [\"${input:script}\"]\n")
+		_, err = config.Load(path)
+		require.ErrorContains(t, err, "${input:script} can only be resolved by VS Code")
+	})
+
+	t.Run("rejects unresolved references", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeFile(t, dir, "proxy.yaml", "auth:\n  apiKey: ${MCP_PROXY_TEST_UNSET}\n")
+		_, err := config.Load(path)
+		require.ErrorContains(t, err, "MCP_PROXY_TEST_UNSET is not set")
+
+		path = writeFile(t, dir, "secret.yaml", "auth:\n  apiKey: file:missing.key\n")
+		_, err = config.Load(path)
+		require.ErrorContains(t, err, "auth.apiKey")
+
+		path = writeFile(t, dir, "servers.yaml", "servers:\n  broken:\n    args: [x]\n")
+		_, err = config.Load(path)
+		require.ErrorContains(t, err, "server broken has no command")
+	})
+}
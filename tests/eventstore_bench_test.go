@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sabbour/mcp-proxy-go/internal/eventstore"
+)
+
+var benchPayload = []byte(`{"jsonrpc":"2.0","method":"notifications/progress","params":{"progressToken":1,"progress":50}}`)
+
+func BenchmarkMemoryStore(b *testing.B) {
+	b.Run("unbounded", func(b *testing.B) {
+		store := eventstore.NewMemory()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			store.Store("stream", benchPayload)
+		}
+	})
+
+	b.Run("bounded", func(b *testing.B) {
+		store := eventstore.NewMemoryWithOptions(eventstore.MemoryOptions{MaxEventsPerStream: 1000})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			store.Store("stream", benchPayload)
+		}
+	})
+}
+
+func BenchmarkMemoryReplayAfter(b *testing.B) {
+	for _, size := range []int{100, 10000, 100000} {
+		b.Run(fmt.Sprintf("events=%d", size), func(b *testing.B) {
+			store := eventstore.NewMemory()
+			// Other streams must not slow down replay of this one.
+			for i := 0; i < size; i++ {
+				store.Store("other", benchPayload)
+			}
+			ids := make([]string, size)
+			for i := range ids {
+				ids[i] = store.Store("stream", benchPayload)
+			}
+			// Resume ten events from the end, as a reconnecting client would.
+			lastEventID := ids[size-11]
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := 0
+				store.ReplayAfter(lastEventID, func(eventstore.Event) { n++ })
+				if n != 10 {
+					b.Fatalf("replayed %d events, want 10", n)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFileStore(b *testing.B) {
+	for _, sync := range []eventstore.SyncPolicy{eventstore.SyncNever, eventstore.SyncInterval} {
+		b.Run(string(sync), func(b *testing.B) {
+			store, err := eventstore.OpenFile(eventstore.FileOptions{Dir: b.TempDir(), Sync: sync, MaxEventsPerStream: 1000})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer store.Close()
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				store.Store("stream", benchPayload)
+			}
+		})
+	}
+}
+
+func BenchmarkFileReplayAfter(b *testing.B) {
+	store, err := eventstore.OpenFile(eventstore.FileOptions{Dir: b.TempDir(), Sync: eventstore.SyncNever})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.Close()
+
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = store.Store("stream", benchPayload)
+	}
+	lastEventID := ids[len(ids)-11]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		store.ReplayAfter(lastEventID, func(eventstore.Event) { n++ })
+		if n != 10 {
+			b.Fatalf("replayed %d events, want 10", n)
+		}
+	}
+}
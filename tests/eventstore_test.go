@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -76,4 +79,181 @@ func TestMemoryEventStore(t *testing.T) {
 		require.Contains(t, string(replayedA[0].Payload), `"stream": "a"`)
 		require.Contains(t, string(replayedA[0].Payload), `"seq": 2`)
 	})
+
+	t.Run("bounds retention", func(t *testing.T) {
+		store := eventstore.NewMemoryWithOptions(eventstore.MemoryOptions{MaxEventsPerStream: 2, MaxBytes: 9})
+		replay := func(lastEventID string) (string, []string) {
+			var payloads []string
+			streamID := store.ReplayAfter(lastEventID, func(e eventstore.Event) {
+				payloads = append(payloads, string(e.Payload))
+			})
+			return streamID, payloads
+		}
+
+		first := store.Store("a", []byte("1"))
+		second := store.Store("a", []byte("2"))
+		store.Store("a", []byte("3"))
+
+		// The first event is evicted, but nothing after it is missing.
+		streamID, payloads := replay(first)
+		require.Equal(t, "a", streamID)
+		require.Equal(t, []string{"2", "3"}, payloads)
+
+		store.Store("a", []byte("4"))
+		streamID, _ = replay(first)
+		require.Empty(t, streamID, "the second event was evicted by the per-stream limit")
+		_, payloads = replay(second)
+		require.Equal(t, []string{"3", "4"}, payloads)
+
+		// The byte limit evicts the oldest events of any stream.
+		store.Store("b", []byte("12345678"))
+		require.Equal(t, eventstore.Stats{Streams: 2, Events: 2, Bytes: 9, Evicted: 3}, store.Stats())
+
+		store.DeleteStream("b")
+		require.Equal(t, eventstore.Stats{Streams: 1, Events: 1, Bytes: 1, Evicted: 3}, store.Stats())
+	})
+
+	t.Run("expires events after the TTL", func(t *testing.T) {
+		store := eventstore.NewMemoryWithOptions(eventstore.MemoryOptions{TTL: 50 * time.Millisecond})
+
+		old := store.Store("a", []byte("old"))
+		store.Store("a", []byte("older"))
+		time.Sleep(100 * time.Millisecond)
+		store.Store("a", []byte("new"))
+
+		require.Empty(t, store.ReplayAfter(old, func(eventstore.Event) {}))
+		require.Equal(t, 1, store.Stats().Events)
+	})
+
+	t.Run("orders events by sequence", func(t *testing.T) {
+		store := eventstore.NewMemory()
+
+		ids := make([]string, 1000)
+		for i := range ids {
+			ids[i] = store.Store("stream-a", []byte(strconv.Itoa(i)))
+		}
+		require.Equal(t, "stream-a-1", ids[0])
+		require.Equal(t, "stream-a-1000", ids[999])
+
+		var replayed []string
+		store.ReplayAfter(ids[499], func(e eventstore.Event) {
+			replayed = append(replayed, e.ID)
+		})
+		require.Equal(t, ids[500:], replayed)
+
+		require.Empty(t, store.ReplayAfter("stream-a-1001", func(eventstore.Event) {}), "not stored yet")
+		require.Empty(t, store.ReplayAfter("stream-b-1", func(eventstore.Event) {}))
+	})
+}
+
+func TestFileEventStore(t *testing.T) {
+	open := func(t *testing.T, opts eventstore.FileOptions) *eventstore.File {
+		store, err := eventstore.OpenFile(opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+	replay := func(store eventstore.EventStore, lastEventID string) []string {
+		var payloads []string
+		store.ReplayAfter(lastEventID, func(e eventstore.Event) {
+			payloads = append(payloads, string(e.Payload))
+		})
+		return payloads
+	}
+	segments := func(t *testing.T, dir string) []string {
+		matches, err := filepath.Glob(filepath.Join(dir, "*", "*.log"))
+		require.NoError(t, err)
+		return matches
+	}
+
+	t.Run("survives a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, eventstore.FileOptions{Dir: dir, Sync: eventstore.SyncAlways})
+		first := store.Store("session-a", []byte("one"))
+		store.Store("session-a", []byte("two"))
+		store.Store("session-b", []byte("other"))
+		require.NoError(t, store.Close())
+		require.Empty(t, store.Store("session-a", []byte("late")), "closed stores accept nothing")
+
+		store = open(t, eventstore.FileOptions{Dir: dir})
+		require.Equal(t, eventstore.Stats{Streams: 2, Events: 3, Bytes: 11}, store.Stats())
+		require.Equal(t, []string{"two"}, replay(store, first))
+
+		// The sequence carries on where it stopped.
+		require.Equal(t, "session-a-3", store.Store("session-a", []byte("three")))
+		require.Equal(t, []string{"two", "three"}, replay(store, first))
+	})
+
+	t.Run("rolls segments and compacts evicted ones", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, eventstore.FileOptions{Dir: dir, SegmentBytes: 100, MaxEventsPerStream: 3})
+
+		ids := make([]string, 10)
+		for i := range ids {
+			ids[i] = store.Store("s", []byte(`{"event":`+strconv.Itoa(i)+`}`))
+		}
+		require.Equal(t, []string{`{"event":7}`, `{"event":8}`, `{"event":9}`}, replay(store, ids[6]))
+		require.Empty(t, store.ReplayAfter(ids[5], func(eventstore.Event) {}))
+		require.Equal(t, uint64(7), store.Stats().Evicted)
+		require.LessOrEqual(t, len(segments(t, dir)), 3)
+		require.NoError(t, store.Close())
+
+		// Retention is applied again on open.
+		store = open(t, eventstore.FileOptions{Dir: dir, MaxEventsPerStream: 1})
+		require.Equal(t, []string{`{"event":9}`}, replay(store, ids[8]))
+		require.Len(t, segments(t, dir), 1)
+	})
+
+	t.Run("truncates a torn write", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, eventstore.FileOptions{Dir: dir})
+		first := store.Store("s", []byte("one"))
+		store.Store("s", []byte("two"))
+		require.NoError(t, store.Close())
+
+		paths := segments(t, dir)
+		require.Len(t, paths, 1)
+		file, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = file.Write([]byte{0, 0, 0, 9, 1, 2})
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		store = open(t, eventstore.FileOptions{Dir: dir})
+		require.Equal(t, 2, store.Stats().Events)
+		require.Equal(t, "s-3", store.Store("s", []byte("three")))
+		require.Equal(t, []string{"two", "three"}, replay(store, first))
+	})
+
+	t.Run("drops streams of an earlier run", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, eventstore.FileOptions{Dir: dir})
+		first := store.Store("resumed", []byte("one"))
+		store.Store("orphan", []byte("one"))
+		require.NoError(t, store.Close())
+
+		store = open(t, eventstore.FileOptions{Dir: dir, OrphanTTL: 50 * time.Millisecond})
+		store.Store("resumed", []byte("two"))
+		require.Eventually(t, func() bool {
+			return store.Stats().Streams == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, []string{"two"}, replay(store, first))
+		require.Empty(t, replay(store, "orphan-0"))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("deletes streams", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, eventstore.FileOptions{Dir: dir})
+		store.Store("s", []byte("one"))
+		store.DeleteStream("s")
+
+		require.Equal(t, eventstore.Stats{}, store.Stats())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
 }
\ No newline at end of file
@@ -0,0 +1,320 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sabbour/mcp-proxy-go/internal/gateway"
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+)
+
+func TestGateway(t *testing.T) {
+	// alpha serves two pages of tools and a resource, beta one tool and a
+	// prompt.
+	newAlpha := func() *scriptedTransport {
+		return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+			var params struct {
+				Cursor string `json:"cursor"`
+				Name   string `json:"name"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+			switch req.Method {
+			case "initialize":
+				tr.reply(req.ID, map[string]any{
+					"protocolVersion": "2025-06-18",
+					"capabilities": map[string]any{
+						"tools":     map[string]any{},
+						"resources": map[string]any{"subscribe": true},
+					},
+					"instructions": "alpha searches",
+				})
+			case "tools/list":
+				if params.Cursor == "" {
+					tr.reply(req.ID, map[string]any{"tools": []any{map[string]any{"name": "search"}}, "nextCursor": "page-2"})
+				} else {
+					tr.reply(req.ID, map[string]any{"tools": []any{map[string]any{"name": "fetch"}}})
+				}
+			case "tools/call":
+				tr.reply(req.ID, map[string]any{"content": []any{map[string]any{"type": "text", "text": "alpha " + params.Name}}})
+			case "resources/list":
+				tr.reply(req.ID, map[string]any{"resources": []any{map[string]any{"uri": "alpha://doc", "name": "doc"}}})
+			case "resources/read":
+				tr.reply(req.ID, map[string]any{"contents": []any{map[string]any{"uri": "alpha://doc", "text": "alpha doc"}}})
+			}
+		})
+	}
+	newBeta := func() *scriptedTransport {
+		return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+			var params struct {
+				Name string `json:"name"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+			switch req.Method {
+			case "initialize":
+				tr.reply(req.ID, map[string]any{
+					"protocolVersion": "2025-06-18",
+					"capabilities": map[string]any{
+						"tools":   map[string]any{"listChanged": true},
+						"prompts": map[string]any{},
+					},
+				})
+			case "tools/list":
+				tr.reply(req.ID, map[string]any{"tools": []any{map[string]any{"name": "search"}}})
+			case "tools/call":
+				if params.Name == "ask" {
+					tr.emit(map[string]any{"jsonrpc": "2.0", "id": 7, "method": "sampling/createMessage"})
+				}
+				tr.reply(req.ID, map[string]any{"content": []any{map[string]any{"type": "text", "text": "beta " + params.Name}}})
+			case "prompts/list":
+				tr.reply(req.ID, map[string]any{"prompts": []any{map[string]any{"name": "greet"}}})
+			}
+		})
+	}
+
+	start := func(t *testing.T, alpha, beta *scriptedTransport) (*gateway.Gateway, *mcp.Client) {
+		gw := gateway.New(
+			gateway.Backend{Name: "alpha", Prefix: "alpha_", Transport: alpha},
+			gateway.Backend{Name: "beta", Prefix: "beta_", Transport: beta},
+		)
+		client := mcp.NewClient(gw)
+		require.NoError(t, client.Start(context.Background()))
+		t.Cleanup(func() { _ = client.Close() })
+
+		var result map[string]any
+		require.NoError(t, client.BlockingCall(context.Background(), 5*time.Second, "initialize", map[string]any{}, &result))
+		return gw, client
+	}
+
+	names := func(items []any) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.(map[string]any)["name"].(string))
+		}
+		return out
+	}
+
+	t.Run("merges capabilities", func(t *testing.T) {
+		gw := gateway.New(
+			gateway.Backend{Name: "alpha", Prefix: "alpha_", Transport: newAlpha()},
+			gateway.Backend{Name: "beta", Prefix: "beta_", Transport: newBeta()},
+		)
+		client := mcp.NewClient(gw)
+		require.NoError(t, client.Start(context.Background()))
+		defer client.Close()
+
+		var result struct {
+			Capabilities map[string]map[string]any `json:"capabilities"`
+			ServerInfo   map[string]any            `json:"serverInfo"`
+			Instructions string                    `json:"instructions"`
+		}
+		require.NoError(t, client.BlockingCall(context.Background(), 5*time.Second, "initialize", map[string]any{}, &result))
+		require.Equal(t, map[string]any{"listChanged": true}, result.Capabilities["tools"])
+		require.Equal(t, map[string]any{"subscribe": true}, result.Capabilities["resources"])
+		require.Contains(t, result.Capabilities, "prompts")
+		require.Equal(t, "mcp-proxy-gateway", result.ServerInfo["name"])
+		require.Equal(t, "alpha: alpha searches", result.Instructions)
+	})
+
+	t.Run("prefixes names and routes calls", func(t *testing.T) {
+		alpha, beta := newAlpha(), newBeta()
+		_, client := start(t, alpha, beta)
+		ctx := context.Background()
+
+		var prompts struct {
+			Prompts []any `json:"prompts"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "prompts/list", nil, &prompts))
+		require.Equal(t, []string{"beta_greet"}, names(prompts.Prompts))
+
+		var call struct {
+			Content []map[string]any `json:"content"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/call", map[string]any{"name": "beta_search"}, &call))
+		require.Equal(t, "beta search", call.Content[0]["text"])
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/call", map[string]any{"name": "alpha_search"}, &call))
+		require.Equal(t, "alpha search", call.Content[0]["text"])
+
+		var read struct {
+			Contents []map[string]any `json:"contents"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "resources/read", map[string]any{"uri": "alpha://doc"}, &read))
+		require.Equal(t, "alpha doc", read.Contents[0]["text"])
+
+		err := client.BlockingCall(ctx, 5*time.Second, "tools/call", map[string]any{"name": "gamma_search"}, nil)
+		require.ErrorContains(t, err, "unknown tool")
+	})
+
+	t.Run("combines pagination cursors", func(t *testing.T) {
+		_, client := start(t, newAlpha(), newBeta())
+		ctx := context.Background()
+
+		var first struct {
+			Tools      []any  `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/list", nil, &first))
+		require.ElementsMatch(t, []string{"alpha_search", "beta_search"}, names(first.Tools))
+		require.NotEmpty(t, first.NextCursor)
+
+		var second struct {
+			Tools      []any  `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/list", map[string]any{"cursor": first.NextCursor}, &second))
+		require.Equal(t, []string{"alpha_fetch"}, names(second.Tools))
+		require.Empty(t, second.NextCursor)
+
+		err := client.BlockingCall(ctx, 5*time.Second, "tools/list", map[string]any{"cursor": "bogus"}, nil)
+		require.ErrorContains(t, err, "invalid cursor")
+	})
+
+	t.Run("relays server requests", func(t *testing.T) {
+		answers := make(chan mcp.Response, 1)
+		beta := newBeta()
+		beta.onResponse = func(resp mcp.Response) { answers <- resp }
+		gw, client := start(t, newAlpha(), beta)
+
+		requests := make(chan map[string]any, 1)
+		client.OnRequest(func(msg mcp.Message) {
+			var req map[string]any
+			_ = json.Unmarshal(msg.Bytes(), &req)
+			requests <- req
+		})
+
+		require.NoError(t, client.BlockingCall(context.Background(), 5*time.Second, "tools/call", map[string]any{"name": "beta_ask"}, nil))
+		req := <-requests
+		require.Equal(t, "sampling/createMessage", req["method"])
+		require.NotEqual(t, float64(7), req["id"])
+
+		answer, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": "hi"})
+		require.NoError(t, gw.Send(context.Background(), mcp.NewMessage(answer)))
+		select {
+		case resp := <-answers:
+			require.JSONEq(t, "7", string(resp.ID))
+			require.JSONEq(t, `"hi"`, string(resp.Result))
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend did not receive the answer")
+		}
+	})
+
+	t.Run("rebuilds routes on every listing", func(t *testing.T) {
+		// Both backends expose search unprefixed; alpha wins until it stops
+		// listing it.
+		var dropped atomic.Bool
+		backend := func(name string, lists func() []any) *scriptedTransport {
+			return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+				var params struct {
+					Name string `json:"name"`
+				}
+				_ = json.Unmarshal(req.Params, &params)
+				switch req.Method {
+				case "initialize":
+					tr.reply(req.ID, map[string]any{"protocolVersion": "2025-06-18", "capabilities": map[string]any{"tools": map[string]any{}}})
+				case "tools/list":
+					tr.reply(req.ID, map[string]any{"tools": lists()})
+				case "tools/call":
+					tr.reply(req.ID, map[string]any{"content": []any{map[string]any{"type": "text", "text": name + " " + params.Name}}})
+				}
+			})
+		}
+		alpha := backend("alpha", func() []any {
+			if dropped.Load() {
+				return []any{map[string]any{"name": "fetch"}}
+			}
+			return []any{map[string]any{"name": "search"}}
+		})
+		beta := backend("beta", func() []any { return []any{map[string]any{"name": "search"}} })
+
+		gw := gateway.New(
+			gateway.Backend{Name: "alpha", Transport: alpha},
+			gateway.Backend{Name: "beta", Transport: beta},
+		)
+		client := mcp.NewClient(gw)
+		require.NoError(t, client.Start(context.Background()))
+		t.Cleanup(func() { _ = client.Close() })
+		ctx := context.Background()
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "initialize", map[string]any{}, nil))
+
+		var list struct {
+			Tools []any `json:"tools"`
+		}
+		var call struct {
+			Content []map[string]any `json:"content"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/list", nil, &list))
+		require.Equal(t, []string{"search"}, names(list.Tools))
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/call", map[string]any{"name": "search"}, &call))
+		require.Equal(t, "alpha search", call.Content[0]["text"])
+
+		dropped.Store(true)
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/list", nil, &list))
+		require.ElementsMatch(t, []string{"fetch", "search"}, names(list.Tools))
+		require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/call", map[string]any{"name": "search"}, &call))
+		require.Equal(t, "beta search", call.Content[0]["text"])
+	})
+
+	t.Run("forwards cancellations with the backend's request ID", func(t *testing.T) {
+		calls := make(chan json.RawMessage, 1)
+		cancelled := make(chan map[string]any, 1)
+		alpha := newAlpha()
+		handle := alpha.handle
+		alpha.handle = func(tr *scriptedTransport, req mcp.Request) {
+			switch req.Method {
+			case "tools/call":
+				calls <- req.ID
+			case "notifications/cancelled":
+				var params map[string]any
+				_ = json.Unmarshal(req.Params, &params)
+				cancelled <- params
+			default:
+				handle(tr, req)
+			}
+		}
+		gw, _ := start(t, alpha, newBeta())
+
+		require.NoError(t, gw.Send(context.Background(), mcp.NewMessage([]byte(`{"jsonrpc":"2.0","id":"client-1","method":"tools/call","params":{"name":"alpha_search"}}`))))
+		var backendID json.RawMessage
+		select {
+		case backendID = <-calls:
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend did not receive the call")
+		}
+		require.NotEqual(t, `"client-1"`, string(backendID))
+
+		require.NoError(t, gw.Send(context.Background(), mcp.NewMessage([]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"client-1","reason":"user aborted"}}`))))
+		select {
+		case params := <-cancelled:
+			requestID, _ := json.Marshal(params["requestId"])
+			require.JSONEq(t, string(backendID), string(requestID))
+			require.Equal(t, "user aborted", params["reason"])
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend was not told about the cancellation")
+		}
+	})
+
+	t.Run("closes when every backend is gone", func(t *testing.T) {
+		alpha, beta := newAlpha(), newBeta()
+		gw, _ := start(t, alpha, beta)
+		closed := make(chan struct{})
+		gw.OnClose(func() { close(closed) })
+
+		require.NoError(t, alpha.Close())
+		select {
+		case <-closed:
+			t.Fatal("gateway closed while a backend is left")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		require.NoError(t, beta.Close())
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("gateway did not close")
+		}
+	})
+}
@@ -0,0 +1,371 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sabbour/mcp-proxy-go/internal/httpclient"
+	"github.com/sabbour/mcp-proxy-go/internal/httpserver"
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/proxy"
+	"github.com/sabbour/mcp-proxy-go/internal/stdio"
+)
+
+func TestHTTPClientTransport(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{APIKey: "secret"})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	newClient := func(t *testing.T) (*mcp.Client, *httpclient.Transport) {
+		transport := httpclient.New(httpclient.Options{
+			URL:          baseURL + "/mcp",
+			Headers:      http.Header{"X-Api-Key": []string{"secret"}},
+			RetryBackoff: 10 * time.Millisecond,
+		})
+		client := mcp.NewClient(transport)
+		require.NoError(t, client.Start(context.Background()))
+		t.Cleanup(func() { _ = client.Close() })
+		return client, transport
+	}
+
+	t.Run("initializes and calls the remote server", func(t *testing.T) {
+		client, transport := newClient(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "initialize", map[string]any{}, nil))
+		require.NotEmpty(t, transport.SessionID())
+		require.NoError(t, client.Notify(ctx, "notifications/initialized", nil))
+
+		// The fixture streams progress before the result, so this exercises
+		// the SSE response path.
+		var result struct {
+			Content []map[string]any `json:"content"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "tools/call", map[string]any{
+			"_meta": map[string]any{"progressToken": "p1"},
+		}, &result))
+		require.Equal(t, "done", result.Content[0]["text"])
+	})
+
+	t.Run("reinitializes an expired session", func(t *testing.T) {
+		client, transport := newClient(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "initialize", map[string]any{}, nil))
+		expired := transport.SessionID()
+
+		req, err := http.NewRequest(http.MethodDelete, baseURL+"/mcp", nil)
+		require.NoError(t, err)
+		req.Header.Set("mcp-session-id", expired)
+		req.Header.Set("X-API-Key", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		var result struct {
+			Resources []map[string]any `json:"resources"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "resources/list", nil, &result))
+		require.Len(t, result.Resources, 1)
+		require.NotEqual(t, expired, transport.SessionID())
+	})
+
+	t.Run("receives server notifications on the GET stream", func(t *testing.T) {
+		transport := httpclient.New(httpclient.Options{
+			URL:     baseURL + "/mcp",
+			Headers: http.Header{"X-Api-Key": []string{"secret"}},
+		})
+		received := make(chan map[string]any, 16)
+		transport.OnMessage(func(msg mcp.Message) {
+			var decoded map[string]any
+			require.NoError(t, json.Unmarshal(msg.Bytes(), &decoded))
+			received <- decoded
+		})
+		require.NoError(t, transport.Start(context.Background()))
+		t.Cleanup(func() { _ = transport.Close() })
+
+		send := func(payload string) {
+			require.NoError(t, transport.Send(context.Background(), mcp.NewMessage([]byte(payload))))
+		}
+		send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+		require.Equal(t, float64(1), (<-received)["id"])
+
+		// Give the GET stream a moment to attach before triggering the
+		// notification.
+		time.Sleep(200 * time.Millisecond)
+		send(`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"file:///example.txt"}}`)
+
+		methods := map[string]bool{}
+		for len(methods) < 2 {
+			select {
+			case msg := <-received:
+				if method, ok := msg["method"].(string); ok {
+					methods[method] = true
+				} else {
+					methods["response"] = true
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out, received %v", methods)
+			}
+		}
+		require.True(t, methods["notifications/resources/updated"])
+		require.True(t, methods["response"])
+	})
+
+	t.Run("fails requests the server rejects", func(t *testing.T) {
+		transport := httpclient.New(httpclient.Options{URL: baseURL + "/mcp"})
+		client := mcp.NewClient(transport)
+		require.NoError(t, client.Start(context.Background()))
+		t.Cleanup(func() { _ = client.Close() })
+
+		err := client.BlockingCall(context.Background(), 5*time.Second, "initialize", map[string]any{}, nil)
+		require.ErrorContains(t, err, "401")
+	})
+}
+
+func TestHTTPClientStreamResume(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		gets        int
+		resumedFrom string
+		deleted     string
+	)
+	dropFirst := make(chan struct{})
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req mcp.Request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req.Method == "tools/call" {
+				// The POST stream has event IDs of its own.
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprintf(w, "id: post-1\ndata: {\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":{}}\n\n", req.ID)
+				return
+			}
+			if req.Method != "initialize" {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.Header().Set("mcp-session-id", "s1")
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18"}}`, req.ID)
+
+		case http.MethodGet:
+			mu.Lock()
+			gets++
+			n := gets
+			if n == 2 {
+				resumedFrom = r.Header.Get("Last-Event-ID")
+			}
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "id: e%d\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/n%d\"}\n\n", n, n)
+			w.(http.Flusher).Flush()
+			if n == 1 {
+				// Drop the first stream to force a reconnect.
+				select {
+				case <-dropFirst:
+				case <-r.Context().Done():
+				}
+				return
+			}
+			<-r.Context().Done()
+
+		case http.MethodDelete:
+			mu.Lock()
+			deleted = r.Header.Get("mcp-session-id")
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(remote.Close)
+
+	transport := httpclient.New(httpclient.Options{URL: remote.URL, RetryBackoff: 10 * time.Millisecond})
+	received := make(chan string, 16)
+	transport.OnMessage(func(msg mcp.Message) {
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal(msg.Bytes(), &decoded))
+		if method, ok := decoded["method"].(string); ok {
+			received <- method
+		} else {
+			received <- "response"
+		}
+	})
+	require.NoError(t, transport.Start(context.Background()))
+	require.NoError(t, transport.Send(context.Background(), mcp.NewMessage([]byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`))))
+
+	expect := func(want string) {
+		select {
+		case method := <-received:
+			require.Equal(t, want, method)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	expect("response")
+	expect("notifications/n1")
+	require.NoError(t, transport.Send(context.Background(), mcp.NewMessage([]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{}}`))))
+	expect("response")
+	close(dropFirst)
+	expect("notifications/n2")
+
+	mu.Lock()
+	require.Equal(t, "e1", resumedFrom)
+	mu.Unlock()
+
+	require.NoError(t, transport.Close())
+	mu.Lock()
+	require.Equal(t, "s1", deleted)
+	mu.Unlock()
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		posts = map[string]int{}
+	)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req mcp.Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		posts[req.Method]++
+		n := posts[req.Method]
+		mu.Unlock()
+
+		// Every first attempt fails as if a gateway lost the reply.
+		if req.Method != "initialize" && n == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{}}`, req.ID)
+	}))
+	t.Cleanup(remote.Close)
+
+	client := mcp.NewClient(httpclient.New(httpclient.Options{URL: remote.URL, RetryBackoff: 10 * time.Millisecond}))
+	require.NoError(t, client.Start(context.Background()))
+	t.Cleanup(func() { _ = client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "initialize", map[string]any{}, nil))
+
+	// Listing is safe to repeat, so the 502 is retried.
+	require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "tools/list", nil, nil))
+
+	// The tool may have run before the gateway failed, so it is not called
+	// a second time.
+	err := client.BlockingCall(ctx, 5*time.Second, "tools/call", map[string]any{"name": "charge"}, nil)
+	require.ErrorContains(t, err, "502")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 2, posts["tools/list"])
+	require.Equal(t, 1, posts["tools/call"])
+}
+
+func TestStdioToHTTPBridge(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+
+	local := stdio.NewServerTransport(stdinReader, stdoutWriter)
+	remote := httpclient.New(httpclient.Options{URL: baseURL + "/mcp"})
+	bridge := proxy.NewBridge(local, remote)
+	require.NoError(t, bridge.Start(context.Background()))
+
+	responses := bufio.NewReader(stdoutReader)
+	call := func(id int, method string) map[string]any {
+		_, err := fmt.Fprintf(stdinWriter, `{"jsonrpc":"2.0","id":%d,"method":%q,"params":{}}`+"\n", id, method)
+		require.NoError(t, err)
+
+		line, err := responses.ReadBytes('\n')
+		require.NoError(t, err)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(line, &resp))
+		return resp
+	}
+
+	init := call(1, "initialize")
+	require.Equal(t, float64(1), init["id"])
+	require.Contains(t, init, "result")
+
+	list := call(2, "resources/list")
+	require.Equal(t, float64(2), list["id"])
+	require.Len(t, list["result"].(map[string]any)["resources"], 1)
+
+	// EOF on stdin ends the bridge.
+	require.NoError(t, stdinWriter.Close())
+	select {
+	case <-bridge.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge did not stop after stdin closed")
+	}
+}
+
+func TestSocketToLegacySSEBridge(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	clientConn, proxyConn := net.Pipe()
+	local := stdio.NewConnTransport(proxyConn)
+	remote := httpclient.NewSSE(httpclient.Options{URL: baseURL + "/sse"})
+	bridge := proxy.NewBridge(local, remote)
+	require.NoError(t, bridge.Start(context.Background()))
+
+	responses := bufio.NewReader(clientConn)
+	call := func(id int, method string) map[string]any {
+		_, err := fmt.Fprintf(clientConn, `{"jsonrpc":"2.0","id":%d,"method":%q,"params":{}}`+"\n", id, method)
+		require.NoError(t, err)
+
+		line, err := responses.ReadBytes('\n')
+		require.NoError(t, err)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(line, &resp))
+		return resp
+	}
+
+	init := call(1, "initialize")
+	require.Equal(t, float64(1), init["id"])
+	require.Contains(t, init, "result")
+
+	list := call(2, "resources/list")
+	require.Equal(t, float64(2), list["id"])
+	require.Len(t, list["result"].(map[string]any)["resources"], 1)
+
+	// Ending the SSE stream closes the bridge and the socket with it.
+	require.NoError(t, remote.Close())
+	select {
+	case <-bridge.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge did not stop after the SSE stream closed")
+	}
+	_, err := responses.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+}
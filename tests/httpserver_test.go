@@ -12,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/sabbour/mcp-proxy-go/internal/eventstore"
 	"github.com/sabbour/mcp-proxy-go/internal/httpserver"
 	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/registry"
 	"github.com/sabbour/mcp-proxy-go/internal/stdio"
 )
 
@@ -136,13 +139,14 @@ func TestHTTPProxySSE(t *testing.T) {
 
 	// Use a channel to coordinate the test
 	done := make(chan bool, 1)
-	
+
 	go func() {
 		defer func() { done <- true }()
 		postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
 			"jsonrpc": "2.0",
 			"id":      5,
-			"method":  "resources/list",
+			"method":  "resources/subscribe",
+			"params":  map[string]any{"uri": "file:///example.txt"},
 		})
 	}()
 
@@ -162,7 +166,10 @@ func TestHTTPProxySSE(t *testing.T) {
 
 			if strings.HasPrefix(line, "data:") {
 				payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-				if strings.Contains(payload, "resources") {
+				// Responses stay on the POST stream; the SSE stream carries
+				// the server's own messages.
+				require.NotContains(t, payload, `"id":5`)
+				if strings.Contains(payload, "notifications/resources/updated") {
 					// Wait for the goroutine to complete
 					<-done
 					return
@@ -174,6 +181,977 @@ func TestHTTPProxySSE(t *testing.T) {
 	t.Fatalf("did not receive SSE event in time")
 }
 
+func TestHTTPProxyStreamGet(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+
+	resp := getStream(t, baseURL+"/mcp", sessionID, "")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+
+	post := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "resources/subscribe",
+		"params":  map[string]any{"uri": "file:///example.txt"},
+	})
+	require.Equal(t, http.StatusOK, post.StatusCode)
+	_ = post.Body.Close()
+
+	for {
+		ev := readSSEEvent(t, reader)
+		if strings.Contains(ev.Data, "notifications/resources/updated") {
+			require.Contains(t, ev.Data, "file:///example.txt")
+			break
+		}
+	}
+
+	missing := getStream(t, baseURL+"/mcp", "unknown", "")
+	defer missing.Body.Close()
+	require.Equal(t, http.StatusNotFound, missing.StatusCode)
+}
+
+func TestHTTPProxyStreamResume(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+	// Every subscription makes the server send a resources/updated
+	// notification for the URI on the GET stream.
+	subscribe := func(id int) {
+		resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"method":  "resources/subscribe",
+			"params":  map[string]any{"uri": fmt.Sprintf("file:///%d", id)},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+	updated := func(reader *bufio.Reader) (sseEvent, string) {
+		for {
+			ev := readSSEEvent(t, reader)
+			var msg struct {
+				ID     any    `json:"id"`
+				Method string `json:"method"`
+				Params struct {
+					URI string `json:"uri"`
+				} `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(ev.Data), &msg))
+			require.Nil(t, msg.ID, "responses are not sent on the GET stream")
+			if msg.Method == "notifications/resources/updated" {
+				return ev, msg.Params.URI
+			}
+		}
+	}
+
+	first := getStream(t, baseURL+"/mcp", sessionID, "")
+	subscribe(2)
+	subscribe(3)
+	ev, uri := updated(bufio.NewReader(first.Body))
+	require.Equal(t, "file:///2", uri)
+	require.NotEmpty(t, ev.ID)
+	_ = first.Body.Close()
+
+	// Sent while no stream is attached.
+	subscribe(4)
+
+	resumed := getStream(t, baseURL+"/mcp", sessionID, ev.ID)
+	defer resumed.Body.Close()
+	require.Equal(t, http.StatusOK, resumed.StatusCode)
+	reader := bufio.NewReader(resumed.Body)
+
+	var uris []string
+	for len(uris) < 3 {
+		if len(uris) == 2 {
+			subscribe(5)
+		}
+		_, uri := updated(reader)
+		uris = append(uris, uri)
+	}
+
+	require.Equal(t, []string{"file:///3", "file:///4", "file:///5"}, uris)
+}
+
+func TestHTTPProxyResumeAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	start := func(t *testing.T) (*httpserver.Server, string, *eventstore.File) {
+		store, err := eventstore.OpenFile(eventstore.FileOptions{Dir: dir, Sync: eventstore.SyncAlways})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		server, baseURL := startTestServer(t, httpserver.Options{
+			CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) {
+				return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+					tr.reply(req.ID, map[string]any{})
+					for i := 1; i <= 2; i++ {
+						tr.emit(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{"data": i}})
+					}
+				}), nil
+			},
+			EventStoreFactory: func() eventstore.EventStore { return store },
+		})
+		return server, baseURL, store
+	}
+
+	server, baseURL, store := start(t)
+	sessionID := initializeSession(t, baseURL, "")
+	require.Eventually(t, func() bool {
+		return store.Stats().Events == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, server.Close(context.Background()))
+	require.NoError(t, store.Close())
+
+	server, baseURL, _ = start(t)
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	// The session is gone, but its stream is replayed before it ends.
+	resp := getStream(t, baseURL+"/mcp", sessionID, eventstore.FormatID(sessionID, 1))
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	reader := bufio.NewReader(resp.Body)
+	ev := readSSEEvent(t, reader)
+	require.Equal(t, eventstore.FormatID(sessionID, 2), ev.ID)
+	require.Contains(t, ev.Data, `"data":2`)
+	_, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	// Anything else tells the client to initialize again.
+	resp = getStream(t, baseURL+"/mcp", sessionID, "")
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = getStream(t, baseURL+"/mcp", "other", eventstore.FormatID(sessionID, 1))
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHTTPProxyStreamedResponse(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+
+	resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name":  "slow",
+			"_meta": map[string]any{"progressToken": "tok-1"},
+		},
+	}, header("Accept", "application/json, text/event-stream"))
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	for step := 1; step <= 2; step++ {
+		ev := readSSEEvent(t, reader)
+		require.Contains(t, ev.Data, "notifications/progress")
+		require.Contains(t, ev.Data, `"tok-1"`)
+	}
+
+	final := readSSEEvent(t, reader)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(final.Data), &body))
+	require.EqualValues(t, 2, body["id"])
+	require.Contains(t, body, "result")
+
+	// The stream closes once the response has been delivered.
+	_, err := reader.ReadString('\n')
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestHTTPProxyJSONResponseForced(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{EnableJSONResponse: true})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+
+	resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "slow"},
+	}, header("Accept", "application/json, text/event-stream"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var body map[string]any
+	decodeBody(t, resp.Body, &body)
+	require.Contains(t, body, "result")
+}
+
+func TestHTTPProxyBatch(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	resp := postJSON(t, baseURL+"/mcp", "", []any{
+		map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize"},
+		map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	sessionID := resp.Header.Get("mcp-session-id")
+	require.NotEmpty(t, sessionID)
+
+	var initialized []map[string]any
+	decodeBody(t, resp.Body, &initialized)
+	require.Len(t, initialized, 1)
+	require.EqualValues(t, 1, initialized[0]["id"])
+
+	resp = postJSON(t, baseURL+"/mcp", sessionID, []any{
+		map[string]any{"jsonrpc": "2.0", "id": 3, "method": "resources/read", "params": map[string]any{"uri": "file:///example.txt"}},
+		map[string]any{"jsonrpc": "2.0", "id": 2, "method": "resources/list"},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var responses []map[string]any
+	decodeBody(t, resp.Body, &responses)
+	require.Len(t, responses, 2)
+	require.EqualValues(t, 3, responses[0]["id"])
+	require.EqualValues(t, 2, responses[1]["id"])
+
+	resp = postJSON(t, baseURL+"/mcp", sessionID, []any{
+		map[string]any{"jsonrpc": "2.0", "method": "notifications/roots/list_changed"},
+	})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	resp = postJSON(t, baseURL+"/mcp", sessionID, []any{
+		map[string]any{"jsonrpc": "2.0", "id": 4, "method": "resources/list"},
+		map[string]any{"jsonrpc": "2.0", "id": 5, "method": "resources/templates/list"},
+	}, header("Accept", "application/json, text/event-stream"))
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	seen := map[float64]bool{}
+	for len(seen) < 2 {
+		var msg map[string]any
+		require.NoError(t, json.Unmarshal([]byte(readSSEEvent(t, reader).Data), &msg))
+		seen[msg["id"].(float64)] = true
+	}
+	require.True(t, seen[4])
+	require.True(t, seen[5])
+}
+
+func TestHTTPProxyCancellation(t *testing.T) {
+	backend := newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+		if req.Method == "initialize" {
+			tr.reply(req.ID, map[string]any{})
+		}
+		// tools/call never completes.
+	})
+
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) {
+			return backend, nil
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+
+	stream := getStream(t, baseURL+"/mcp", sessionID, "")
+	defer stream.Body.Close()
+
+	reqBytes, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      "call-1",
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "slow"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/mcp", bytes.NewReader(reqBytes))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("mcp-session-id", sessionID)
+	_, err = http.DefaultClient.Do(req)
+	require.Error(t, err)
+
+	var cancelled mcp.Request
+	require.Eventually(t, func() bool {
+		for _, msg := range backend.received() {
+			var req mcp.Request
+			if json.Unmarshal(msg.Bytes(), &req) == nil && req.Method == "notifications/cancelled" {
+				cancelled = req
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+
+	var params map[string]any
+	require.NoError(t, json.Unmarshal(cancelled.Params, &params))
+	require.Equal(t, "call-1", params["requestId"])
+	require.NotEmpty(t, params["reason"])
+
+	// A late response is dropped; the next message on the stream is the
+	// notification that follows it.
+	backend.emit(map[string]any{"jsonrpc": "2.0", "id": "call-1", "result": map[string]any{}})
+	backend.emit(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{"data": "after"}})
+
+	ev := readSSEEvent(t, bufio.NewReader(stream.Body))
+	require.Contains(t, ev.Data, "notifications/message")
+}
+
+func TestHTTPProxyServerRequests(t *testing.T) {
+	// tools/call asks the client for a sampling result before completing. The
+	// request carries the call's _meta, relating it to the call.
+	newBackend := func() *scriptedTransport {
+		answers := make(chan mcp.Response, 1)
+		backend := newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+			switch req.Method {
+			case "initialize":
+				tr.reply(req.ID, map[string]any{})
+			case "tools/call":
+				params := map[string]any{"maxTokens": 10}
+				var call struct {
+					Meta json.RawMessage `json:"_meta"`
+				}
+				if json.Unmarshal(req.Params, &call) == nil && len(call.Meta) > 0 {
+					params["_meta"] = call.Meta
+				}
+				tr.emit(map[string]any{
+					"jsonrpc": "2.0",
+					"id":      "srv-1",
+					"method":  "sampling/createMessage",
+					"params":  params,
+				})
+				answer := <-answers
+				tr.reply(req.ID, map[string]any{"sampled": json.RawMessage(answer.Result)})
+			}
+		})
+		backend.onResponse = func(resp mcp.Response) { answers <- resp }
+		return backend
+	}
+
+	answer := func(t *testing.T, baseURL, sessionID, data string) {
+		var msg map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &msg))
+		require.Equal(t, "sampling/createMessage", msg["method"])
+
+		resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      msg["id"],
+			"result":  "hello",
+		})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+
+	t.Run("on the POST stream of the related call", func(t *testing.T) {
+		backend := newBackend()
+		server, baseURL := startTestServer(t, httpserver.Options{
+			CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) { return backend, nil },
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+		resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      2,
+			"method":  "tools/call",
+			"params":  map[string]any{"_meta": map[string]any{"progressToken": "call-2"}},
+		}, header("Accept", "application/json, text/event-stream"))
+		defer resp.Body.Close()
+
+		reader := bufio.NewReader(resp.Body)
+		answer(t, baseURL, sessionID, readSSEEvent(t, reader).Data)
+
+		final := readSSEEvent(t, reader)
+		require.Contains(t, final.Data, `"sampled":"hello"`)
+	})
+
+	t.Run("on the GET stream when unrelated to a call", func(t *testing.T) {
+		backend := newBackend()
+		server, baseURL := startTestServer(t, httpserver.Options{
+			CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) { return backend, nil },
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+		stream := getStream(t, baseURL+"/mcp", sessionID, "")
+		defer stream.Body.Close()
+
+		// The POST stream's headers are only written with its first event.
+		result := make(chan *http.Response, 1)
+		go func() {
+			result <- postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+				"jsonrpc": "2.0",
+				"id":      2,
+				"method":  "tools/call",
+			}, header("Accept", "application/json, text/event-stream"))
+		}()
+
+		answer(t, baseURL, sessionID, readSSEEvent(t, bufio.NewReader(stream.Body)).Data)
+
+		select {
+		case resp := <-result:
+			defer resp.Body.Close()
+			final := readSSEEvent(t, bufio.NewReader(resp.Body))
+			require.Contains(t, final.Data, `"sampled":"hello"`)
+		case <-time.After(5 * time.Second):
+			t.Fatal("tools/call did not complete")
+		}
+	})
+
+	t.Run("on a GET stream opened later", func(t *testing.T) {
+		backend := newBackend()
+		server, baseURL := startTestServer(t, httpserver.Options{
+			CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) { return backend, nil },
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+
+		result := make(chan map[string]any, 1)
+		go func() {
+			resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+				"jsonrpc": "2.0",
+				"id":      2,
+				"method":  "tools/call",
+			})
+			var body map[string]any
+			decodeBody(t, resp.Body, &body)
+			result <- body
+		}()
+
+		require.Eventually(t, func() bool {
+			return len(backend.received()) >= 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		stream := getStream(t, baseURL+"/mcp", sessionID, "")
+		defer stream.Body.Close()
+		answer(t, baseURL, sessionID, readSSEEvent(t, bufio.NewReader(stream.Body)).Data)
+
+		select {
+		case body := <-result:
+			require.Equal(t, map[string]any{"sampled": "hello"}, body["result"])
+		case <-time.After(5 * time.Second):
+			t.Fatal("tools/call did not complete")
+		}
+	})
+}
+
+func TestHTTPProxySessionLimits(t *testing.T) {
+	t.Run("idle sessions are reaped", func(t *testing.T) {
+		closed := make(chan httpserver.CloseReason, 1)
+		server, baseURL := startTestServer(t, httpserver.Options{
+			SessionIdleTimeout: 200 * time.Millisecond,
+			OnClose: func(_ string, reason httpserver.CloseReason) {
+				closed <- reason
+			},
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+
+		select {
+		case reason := <-closed:
+			require.Equal(t, httpserver.CloseReasonIdle, reason)
+		case <-time.After(5 * time.Second):
+			t.Fatal("idle session was not reaped")
+		}
+
+		resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      2,
+			"method":  "resources/list",
+		})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("sessions are closed after their max lifetime", func(t *testing.T) {
+		closed := make(chan httpserver.CloseReason, 1)
+		server, baseURL := startTestServer(t, httpserver.Options{
+			SessionMaxLifetime: 300 * time.Millisecond,
+			OnClose: func(_ string, reason httpserver.CloseReason) {
+				closed <- reason
+			},
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+		stream := getStream(t, baseURL+"/mcp", sessionID, "")
+		defer stream.Body.Close()
+
+		select {
+		case reason := <-closed:
+			require.Equal(t, httpserver.CloseReasonLifetime, reason)
+		case <-time.After(5 * time.Second):
+			t.Fatal("session outlived its max lifetime")
+		}
+	})
+
+	t.Run("max sessions returns 503", func(t *testing.T) {
+		server, baseURL := startTestServer(t, httpserver.Options{MaxSessions: 1})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+
+		resp := postJSON(t, baseURL+"/mcp", "", map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "initialize",
+		})
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+		req, err := http.NewRequest(http.MethodDelete, baseURL+"/mcp", nil)
+		require.NoError(t, err)
+		req.Header.Set("mcp-session-id", sessionID)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		initializeSession(t, baseURL, "")
+	})
+
+	t.Run("closed sessions purge their events", func(t *testing.T) {
+		store := eventstore.NewMemory()
+		server, baseURL := startTestServer(t, httpserver.Options{
+			CreateTransport: func(ctx context.Context, _ *http.Request) (mcp.Transport, error) {
+				return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+					tr.reply(req.ID, map[string]any{})
+					tr.emit(map[string]any{"jsonrpc": "2.0", "method": "notifications/message"})
+				}), nil
+			},
+			EventStoreFactory: func() eventstore.EventStore { return store },
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+
+		sessionID := initializeSession(t, baseURL, "")
+		require.Eventually(t, func() bool {
+			return store.Stats().Streams == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		req, err := http.NewRequest(http.MethodDelete, baseURL+"/mcp", nil)
+		require.NoError(t, err)
+		req.Header.Set("mcp-session-id", sessionID)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		require.Eventually(t, func() bool {
+			return store.Stats() == eventstore.Stats{}
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestHTTPProxyMetrics(t *testing.T) {
+	var unavailable atomic.Bool
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: func(ctx context.Context, _ *http.Request) (mcp.Transport, error) {
+			if unavailable.Load() {
+				return nil, fmt.Errorf("pool empty: %w", httpserver.ErrUnavailable)
+			}
+			return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+				tr.reply(req.ID, map[string]any{})
+			}), nil
+		},
+		Metrics: func(w io.Writer) {
+			fmt.Fprintln(w, "custom_metric 42")
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	initializeSession(t, baseURL, "")
+
+	resp, err := http.Get(baseURL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), "mcp_proxy_sessions 1\n")
+	require.Contains(t, string(body), "custom_metric 42\n")
+
+	unavailable.Store(true)
+	resp = postJSON(t, baseURL+"/mcp", "", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+	})
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
+
+func TestHTTPProxyGracefulShutdown(t *testing.T) {
+	backend := newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+		switch req.Method {
+		case "initialize":
+			tr.reply(req.ID, map[string]any{})
+		case "tools/call":
+			time.Sleep(300 * time.Millisecond)
+			tr.reply(req.ID, map[string]any{"done": true})
+		}
+	})
+
+	closed := make(chan httpserver.CloseReason, 1)
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) { return backend, nil },
+		OnClose: func(_ string, reason httpserver.CloseReason) {
+			closed <- reason
+		},
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+	stream := getStream(t, baseURL+"/mcp", sessionID, "")
+	defer stream.Body.Close()
+
+	inFlight := make(chan *http.Response, 1)
+	go func() {
+		inFlight <- postJSON(t, baseURL+"/mcp", sessionID, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      2,
+			"method":  "tools/call",
+		})
+	}()
+	require.Eventually(t, func() bool {
+		return len(backend.received()) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Close(ctx))
+
+	ev := readSSEEvent(t, bufio.NewReader(stream.Body))
+	require.Contains(t, ev.Data, "mcp-proxy/shutdown")
+
+	resp := <-inFlight
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body map[string]any
+	decodeBody(t, resp.Body, &body)
+	require.Equal(t, map[string]any{"done": true}, body["result"])
+
+	select {
+	case reason := <-closed:
+		require.Equal(t, httpserver.CloseReasonShutdown, reason)
+	default:
+		t.Fatal("session was not closed on shutdown")
+	}
+	require.True(t, backend.isClosed())
+}
+
+func TestHTTPProxyShutdownWaitsForTransports(t *testing.T) {
+	backend := &slowCloseTransport{
+		scriptedTransport: newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+			if req.Method == "initialize" {
+				tr.reply(req.ID, map[string]any{})
+			}
+		}),
+		delay: 300 * time.Millisecond,
+	}
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport:  func(context.Context, *http.Request) (mcp.Transport, error) { return backend, nil },
+		TerminateTimeout: time.Second,
+	})
+	initializeSession(t, baseURL, "")
+
+	// Draining used up the whole grace period; the transport still gets its
+	// own time to exit.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = server.Close(ctx)
+
+	require.True(t, backend.isClosed())
+}
+
+func TestHTTPProxyLegacySSE(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	resp, err := http.Get(baseURL + "/sse")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+
+	endpoint := readSSEEvent(t, reader)
+	require.Equal(t, "endpoint", endpoint.Event)
+	require.True(t, strings.HasPrefix(endpoint.Data, "/messages?sessionId="))
+
+	post := postJSON(t, baseURL+endpoint.Data, "", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+	})
+	require.Equal(t, http.StatusAccepted, post.StatusCode)
+
+	message := readSSEEvent(t, reader)
+	require.Equal(t, "message", message.Event)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(message.Data), &body))
+	require.EqualValues(t, 1, body["id"])
+	require.Contains(t, body, "result")
+
+	post = postJSON(t, baseURL+"/messages?sessionId=unknown", "", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "resources/list",
+	})
+	require.Equal(t, http.StatusNotFound, post.StatusCode)
+}
+
+func TestHTTPProxyRoutes(t *testing.T) {
+	serve := func(name string) func(context.Context, *http.Request) (mcp.Transport, error) {
+		return func(context.Context, *http.Request) (mcp.Transport, error) {
+			return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+				tr.reply(req.ID, map[string]any{"server": name})
+			}), nil
+		}
+	}
+
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: serve("root"),
+		Routes: []httpserver.Route{
+			{Name: "github", APIKey: "gh-key", CreateTransport: serve("github")},
+			{Name: "fs", Stateless: true, CreateTransport: serve("fs")},
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	call := func(url, sessionID string, headers ...func(*http.Request)) (*http.Response, string) {
+		resp := postJSON(t, url, sessionID, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      2,
+			"method":  "tools/call",
+		}, headers...)
+		defer resp.Body.Close()
+		var body struct {
+			Result struct {
+				Server string `json:"server"`
+			} `json:"result"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body.Result.Server
+	}
+
+	resp := postJSON(t, baseURL+"/servers/github/mcp", "", map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize"})
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	githubSession := initializeSession(t, baseURL+"/servers/github", "gh-key")
+	resp, name := call(baseURL+"/servers/github/mcp", githubSession, header("X-API-Key", "gh-key"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "github", name)
+
+	rootSession := initializeSession(t, baseURL, "")
+	_, name = call(baseURL+"/mcp", rootSession)
+	require.Equal(t, "root", name)
+
+	// Sessions belong to the endpoints that created them.
+	resp, _ = call(baseURL+"/mcp", githubSession)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = call(baseURL+"/servers/github/mcp", rootSession, header("X-API-Key", "gh-key"))
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, name = call(baseURL+"/servers/fs/mcp", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("mcp-session-id"))
+	require.Equal(t, "fs", name)
+
+	resp, _ = call(baseURL+"/servers/unknown/mcp", "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	sse, err := http.Get(baseURL + "/servers/fs/sse")
+	require.NoError(t, err)
+	defer sse.Body.Close()
+	endpoint := readSSEEvent(t, bufio.NewReader(sse.Body))
+	require.True(t, strings.HasPrefix(endpoint.Data, "/servers/fs/messages?sessionId="), endpoint.Data)
+}
+
+func TestHTTPProxyReload(t *testing.T) {
+	serve := func(version string) func(context.Context, *http.Request) (mcp.Transport, error) {
+		return func(context.Context, *http.Request) (mcp.Transport, error) {
+			return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+				tr.reply(req.ID, map[string]any{"version": version})
+			}), nil
+		}
+	}
+	call := func(url, sessionID, apiKey string) (int, string) {
+		resp := postJSON(t, url, sessionID, map[string]any{"jsonrpc": "2.0", "id": 2, "method": "tools/call"}, header("X-API-Key", apiKey))
+		defer resp.Body.Close()
+		var body struct {
+			Result struct {
+				Version string `json:"version"`
+			} `json:"result"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Result.Version
+	}
+
+	closed := make(chan httpserver.CloseReason, 4)
+	onClose := func(_ string, reason httpserver.CloseReason) { closed <- reason }
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: serve("v1"),
+		Routes:          []httpserver.Route{{Name: "old", CreateTransport: serve("old")}},
+		OnClose:         onClose,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	sessionID := initializeSession(t, baseURL, "")
+	oldSession := initializeSession(t, baseURL+"/servers/old", "")
+
+	require.NoError(t, server.Reload(httpserver.Options{
+		APIKey:          "new-key",
+		CreateTransport: serve("v2"),
+		Routes:          []httpserver.Route{{Name: "added", CreateTransport: serve("added")}},
+		MaxSessions:     3,
+	}))
+
+	// The new key applies at once, but the session keeps its transport.
+	code, _ := call(baseURL+"/mcp", sessionID, "")
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, version := call(baseURL+"/mcp", sessionID, "new-key")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "v1", version)
+
+	newSession := initializeSession(t, baseURL, "new-key")
+	_, version = call(baseURL+"/mcp", newSession, "new-key")
+	require.Equal(t, "v2", version)
+
+	// Sessions of a removed route are closed and the route is gone.
+	require.Equal(t, httpserver.CloseReasonRouteRemoved, <-closed)
+	code, _ = call(baseURL+"/servers/old/mcp", oldSession, "new-key")
+	require.Equal(t, http.StatusNotFound, code)
+
+	addedSession := initializeSession(t, baseURL+"/servers/added", "new-key")
+	require.NotEmpty(t, addedSession)
+
+	// A fourth live session exceeds the new limit.
+	resp := postJSON(t, baseURL+"/mcp", "", map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize"}, header("X-API-Key", "new-key"))
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	require.Error(t, server.Reload(httpserver.Options{
+		Routes: []httpserver.Route{{Name: "a/b", CreateTransport: serve("bad")}},
+	}))
+	_, version = call(baseURL+"/servers/added/mcp", addedSession, "new-key")
+	require.Equal(t, "added", version)
+}
+
+func TestHTTPProxyForwarding(t *testing.T) {
+	sessions, err := registry.NewFile(t.TempDir())
+	require.NoError(t, err)
+
+	replica := func(name string) string {
+		server, baseURL := startTestServer(t, httpserver.Options{
+			Registry: sessions,
+			CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) {
+				return newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+					if req.Method == "tools/call" {
+						tr.emit(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{"replica": name}})
+					}
+					tr.reply(req.ID, map[string]any{"replica": name})
+				}), nil
+			},
+		})
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(context.Background()))
+		})
+		return baseURL
+	}
+	owner, other := replica("owner"), replica("other")
+	call := func(baseURL, sessionID, method string) (int, string) {
+		resp := postJSON(t, baseURL+"/mcp", sessionID, map[string]any{"jsonrpc": "2.0", "id": 2, "method": method})
+		defer resp.Body.Close()
+		var body struct {
+			Result struct {
+				Replica string `json:"replica"`
+			} `json:"result"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Result.Replica
+	}
+
+	sessionID := initializeSession(t, owner, "")
+	registered, err := sessions.Lookup(sessionID)
+	require.NoError(t, err)
+	require.Equal(t, owner, registered)
+
+	// Requests reaching the other replica are served by the owner.
+	code, served := call(other, sessionID, "tools/list")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "owner", served)
+
+	// So are streams, event by event.
+	stream := getStream(t, other+"/mcp", sessionID, "")
+	defer stream.Body.Close()
+	require.Equal(t, http.StatusOK, stream.StatusCode)
+	_, served = call(other, sessionID, "tools/call")
+	require.Equal(t, "owner", served)
+	require.Contains(t, readSSEEvent(t, bufio.NewReader(stream.Body)).Data, `"replica":"owner"`)
+
+	req, err := http.NewRequest(http.MethodDelete, other+"/mcp", nil)
+	require.NoError(t, err)
+	req.Header.Set("mcp-session-id", sessionID)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	require.Eventually(t, func() bool {
+		registered, err := sessions.Lookup(sessionID)
+		return err == nil && registered == ""
+	}, 5*time.Second, 10*time.Millisecond)
+	code, _ = call(other, sessionID, "tools/list")
+	require.Equal(t, http.StatusNotFound, code)
+
+	// An unreachable owner may come back, so its session is not ended.
+	require.NoError(t, sessions.Register("orphan", fmt.Sprintf("http://127.0.0.1:%d", freePort(t))))
+	code, _ = call(other, "orphan", "tools/list")
+	require.Equal(t, http.StatusBadGateway, code)
+
+	// Once the registry forgets it, it ends like any unknown session.
+	require.NoError(t, sessions.Unregister("orphan"))
+	code, _ = call(other, "orphan", "tools/list")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
 func startTestServer(t *testing.T, opts httpserver.Options) (*httpserver.Server, string) {
 	t.Helper()
 
@@ -184,16 +1162,23 @@ func startTestServer(t *testing.T, opts httpserver.Options) (*httpserver.Server,
 
 	opts.Host = host
 	opts.Port = port
-	opts.EventStoreFactory = func() *eventstore.Memory {
-		return eventstore.NewMemory()
-	}
-	opts.CreateTransport = func(ctx context.Context, _ *http.Request) (mcp.Transport, error) {
-		params := stdio.Params{
-			Command: "go",
-			Args:    []string{"run", "./fixtures/simple_stdio_server.go"},
-			Dir:     root,
+	if opts.Registry != nil && opts.AdvertiseURL == "" {
+		opts.AdvertiseURL = fmt.Sprintf("http://%s:%d", host, port)
+	}
+	if opts.EventStoreFactory == nil {
+		opts.EventStoreFactory = func() eventstore.EventStore {
+			return eventstore.NewMemory()
+		}
+	}
+	if opts.CreateTransport == nil {
+		opts.CreateTransport = func(ctx context.Context, _ *http.Request) (mcp.Transport, error) {
+			params := stdio.Params{
+				Command: "go",
+				Args:    []string{"run", "./fixtures/simple_stdio_server.go"},
+				Dir:     root,
+			}
+			return stdio.NewClient(params), nil
 		}
-		return stdio.NewClient(params), nil
 	}
 
 	srv, err := httpserver.Start(opts)
@@ -205,6 +1190,110 @@ func startTestServer(t *testing.T, opts httpserver.Options) (*httpserver.Server,
 	return srv, baseURL
 }
 
+// scriptedTransport is an in-process mcp.Transport whose replies are produced
+// by a handler, for tests that need precise control over the backend.
+type scriptedTransport struct {
+	handle     func(*scriptedTransport, mcp.Request)
+	onResponse func(mcp.Response)
+	mu         sync.Mutex
+	messages   []mcp.Message
+	onMsg      func(mcp.Message)
+	onClose    func()
+	closed     bool
+}
+
+func newScriptedTransport(handle func(*scriptedTransport, mcp.Request)) *scriptedTransport {
+	return &scriptedTransport{handle: handle}
+}
+
+func (s *scriptedTransport) Start(context.Context) error { return nil }
+
+func (s *scriptedTransport) Send(_ context.Context, msg mcp.Message) error {
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	s.mu.Unlock()
+
+	var req mcp.Request
+	if err := json.Unmarshal(msg.Bytes(), &req); err == nil && req.Method != "" {
+		go s.handle(s, req)
+		return nil
+	}
+
+	var resp mcp.Response
+	if err := json.Unmarshal(msg.Bytes(), &resp); err == nil && len(resp.ID) > 0 && s.onResponse != nil {
+		s.onResponse(resp)
+	}
+	return nil
+}
+
+// slowCloseTransport takes delay to exit, like a child process that
+// outlives SIGTERM for a while.
+type slowCloseTransport struct {
+	*scriptedTransport
+	delay time.Duration
+}
+
+func (s *slowCloseTransport) Close() error {
+	time.Sleep(s.delay)
+	return s.scriptedTransport.Close()
+}
+
+func (s *scriptedTransport) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	onClose := s.onClose
+	s.mu.Unlock()
+
+	if onClose != nil {
+		onClose()
+	}
+	return nil
+}
+
+func (s *scriptedTransport) OnMessage(fn func(mcp.Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onMsg = fn
+}
+
+func (s *scriptedTransport) OnError(func(error)) {}
+
+func (s *scriptedTransport) OnClose(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClose = fn
+}
+
+func (s *scriptedTransport) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *scriptedTransport) received() []mcp.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mcp.Message(nil), s.messages...)
+}
+
+func (s *scriptedTransport) emit(payload any) {
+	raw, _ := json.Marshal(payload)
+	s.mu.Lock()
+	onMsg := s.onMsg
+	s.mu.Unlock()
+	if onMsg != nil {
+		onMsg(mcp.NewMessage(raw))
+	}
+}
+
+func (s *scriptedTransport) reply(id json.RawMessage, result any) {
+	s.emit(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
 func waitForServer(t *testing.T, baseURL string) {
 	t.Helper()
 
@@ -276,6 +1365,24 @@ func postJSON(t *testing.T, url, sessionID string, payload any, headers ...func(
 	return resp
 }
 
+func getStream(t *testing.T, url, sessionID, lastEventID string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	if sessionID != "" {
+		req.Header.Set("mcp-session-id", sessionID)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
 func decodeBody(t *testing.T, r io.ReadCloser, v any) {
 	t.Helper()
 	defer r.Close()
@@ -288,4 +1395,54 @@ func header(name, value string) func(*http.Request) {
 			req.Header.Set(name, value)
 		}
 	}
-}
\ No newline at end of file
+}
+
+type sseEvent struct {
+	Event string
+	ID    string
+	Data  string
+}
+
+// readSSEEvent reads the next SSE event, skipping comments.
+func readSSEEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var ev sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if ev.Data != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			ev.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "id:"):
+			ev.ID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			ev.Data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+// readResponseEvent reads SSE events until it finds the JSON-RPC response
+// with the given ID.
+func readResponseEvent(t *testing.T, reader *bufio.Reader, id int) sseEvent {
+	t.Helper()
+
+	for {
+		ev := readSSEEvent(t, reader)
+
+		var msg map[string]any
+		if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+			continue
+		}
+		if msgID, ok := msg["id"].(float64); ok && int(msgID) == id {
+			return ev
+		}
+	}
+}
@@ -56,6 +56,51 @@ func TestIsInitializeRequest(t *testing.T) {
 		oldVersion := `{"jsonrpc": "1.0", "id": 1, "method": "initialize"}`
 		require.False(t, mcp.IsInitializeRequest([]byte(oldVersion)))
 	})
+
+	t.Run("identifies initialize request inside a batch", func(t *testing.T) {
+		batch := `[{"jsonrpc": "2.0", "method": "notify"}, {"jsonrpc": "2.0", "id": 1, "method": "initialize"}]`
+		require.True(t, mcp.IsInitializeRequest([]byte(batch)))
+	})
+
+	t.Run("rejects batch without initialize", func(t *testing.T) {
+		batch := `[{"jsonrpc": "2.0", "id": 1, "method": "other"}]`
+		require.False(t, mcp.IsInitializeRequest([]byte(batch)))
+	})
+}
+
+func TestSplitBatch(t *testing.T) {
+	t.Run("wraps single message", func(t *testing.T) {
+		msgs, batch, err := mcp.SplitBatch([]byte(` {"jsonrpc": "2.0", "id": 1, "method": "test"}`))
+		require.NoError(t, err)
+		require.False(t, batch)
+		require.Len(t, msgs, 1)
+	})
+
+	t.Run("splits batch array", func(t *testing.T) {
+		msgs, batch, err := mcp.SplitBatch([]byte(`[{"jsonrpc": "2.0", "id": 1, "method": "a"}, {"jsonrpc": "2.0", "method": "b"}]`))
+		require.NoError(t, err)
+		require.True(t, batch)
+		require.Len(t, msgs, 2)
+		require.JSONEq(t, `{"jsonrpc": "2.0", "method": "b"}`, string(msgs[1]))
+	})
+
+	t.Run("rejects empty batch", func(t *testing.T) {
+		_, _, err := mcp.SplitBatch([]byte(`[]`))
+		require.Error(t, err)
+	})
+
+	t.Run("rejects invalid JSON", func(t *testing.T) {
+		_, _, err := mcp.SplitBatch([]byte(`{"invalid": json`))
+		require.Error(t, err)
+	})
+}
+
+func TestHasRequests(t *testing.T) {
+	require.True(t, mcp.HasRequests([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "test"}`)))
+	require.False(t, mcp.HasRequests([]byte(`{"jsonrpc": "2.0", "method": "notify"}`)))
+	require.False(t, mcp.HasRequests([]byte(`{"jsonrpc": "2.0", "id": 1, "result": {}}`)))
+	require.True(t, mcp.HasRequests([]byte(`[{"jsonrpc": "2.0", "method": "notify"}, {"jsonrpc": "2.0", "id": 2, "method": "test"}]`)))
+	require.False(t, mcp.HasRequests([]byte(`[{"jsonrpc": "2.0", "method": "notify"}]`)))
 }
 
 func TestIsNotification(t *testing.T) {
@@ -3,6 +3,7 @@ package tests
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -185,4 +186,302 @@ func TestBridge(t *testing.T) {
 		require.True(t, left.closed)
 		require.True(t, right.closed)
 	})
-}
\ No newline at end of file
+
+	t.Run("starts the right transport before the left", func(t *testing.T) {
+		var started []string
+		left := &startRecorder{mockTransport: newMockTransport(), name: "left", started: &started}
+		right := &startRecorder{mockTransport: newMockTransport(), name: "right", started: &started}
+
+		require.NoError(t, proxy.NewBridge(left, right).Start(context.Background()))
+		require.Equal(t, []string{"right", "left"}, started)
+	})
+
+	t.Run("does not start the left transport when the right fails", func(t *testing.T) {
+		var started []string
+		left := &startRecorder{mockTransport: newMockTransport(), name: "left", started: &started}
+		right := &startRecorder{mockTransport: newMockTransport(), name: "right", started: &started, err: errors.New("unreachable")}
+
+		require.ErrorContains(t, proxy.NewBridge(left, right).Start(context.Background()), "unreachable")
+		require.Equal(t, []string{"right"}, started)
+	})
+
+	t.Run("closes the right transport when the left fails to start", func(t *testing.T) {
+		var started []string
+		left := &startRecorder{mockTransport: newMockTransport(), name: "left", started: &started, err: errors.New("no stdin")}
+		right := &startRecorder{mockTransport: newMockTransport(), name: "right", started: &started}
+
+		require.ErrorContains(t, proxy.NewBridge(left, right).Start(context.Background()), "no stdin")
+		require.True(t, right.closed)
+	})
+}
+
+// startRecorder records the order in which transports are started.
+type startRecorder struct {
+	*mockTransport
+	name    string
+	started *[]string
+	err     error
+}
+
+func (s *startRecorder) Start(ctx context.Context) error {
+	*s.started = append(*s.started, s.name)
+	return s.err
+}
+
+func TestMux(t *testing.T) {
+	attach := func(t *testing.T, mux *proxy.Mux) (*proxy.MuxConn, chan map[string]any) {
+		conn, err := mux.Attach()
+		require.NoError(t, err)
+		received := make(chan map[string]any, 16)
+		conn.OnMessage(func(msg mcp.Message) {
+			var decoded map[string]any
+			require.NoError(t, json.Unmarshal(msg.Bytes(), &decoded))
+			received <- decoded
+		})
+		require.NoError(t, conn.Start(context.Background()))
+		return conn, received
+	}
+
+	send := func(t *testing.T, conn *proxy.MuxConn, payload map[string]any) {
+		raw, err := json.Marshal(payload)
+		require.NoError(t, err)
+		require.NoError(t, conn.Send(context.Background(), mcp.NewMessage(raw)))
+	}
+
+	next := func(t *testing.T, received chan map[string]any) map[string]any {
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for message")
+			return nil
+		}
+	}
+
+	lastSent := func(t *testing.T, backend *mockTransport) map[string]any {
+		messages := backend.getMessages()
+		require.NotEmpty(t, messages)
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal(messages[len(messages)-1].Bytes(), &decoded))
+		return decoded
+	}
+
+	reply := func(backend *mockTransport, id any, result any) {
+		raw, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+		backend.simulateMessage(mcp.NewMessage(raw))
+	}
+
+	t.Run("initializes the backend once", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		first, firstReceived := attach(t, mux)
+		send(t, first, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize"})
+		forwarded := lastSent(t, backend)
+		reply(backend, forwarded["id"], map[string]any{"serverInfo": map[string]any{"name": "shared"}})
+		require.Equal(t, float64(1), next(t, firstReceived)["id"])
+		send(t, first, map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"})
+
+		second, secondReceived := attach(t, mux)
+		send(t, second, map[string]any{"jsonrpc": "2.0", "id": "init", "method": "initialize"})
+		send(t, second, map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"})
+
+		resp := next(t, secondReceived)
+		require.Equal(t, "init", resp["id"])
+		require.Equal(t, "shared", resp["result"].(map[string]any)["serverInfo"].(map[string]any)["name"])
+		require.Len(t, backend.getMessages(), 2)
+	})
+
+	t.Run("routes responses and progress to the caller", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		first, firstReceived := attach(t, mux)
+		second, secondReceived := attach(t, mux)
+
+		send(t, first, map[string]any{"jsonrpc": "2.0", "id": 7, "method": "tools/call", "params": map[string]any{"_meta": map[string]any{"progressToken": "tok"}}})
+		fromFirst := lastSent(t, backend)
+		send(t, second, map[string]any{"jsonrpc": "2.0", "id": 7, "method": "tools/list"})
+		fromSecond := lastSent(t, backend)
+		require.NotEqual(t, fromFirst["id"], fromSecond["id"])
+
+		token := fromFirst["params"].(map[string]any)["_meta"].(map[string]any)["progressToken"]
+		require.NotEqual(t, "tok", token)
+		progress, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "notifications/progress", "params": map[string]any{"progressToken": token, "progress": 1}})
+		backend.simulateMessage(mcp.NewMessage(progress))
+
+		reply(backend, fromSecond["id"], map[string]any{"tools": []any{}})
+		reply(backend, fromFirst["id"], map[string]any{"content": "done"})
+
+		notice := next(t, firstReceived)
+		require.Equal(t, "notifications/progress", notice["method"])
+		require.Equal(t, "tok", notice["params"].(map[string]any)["progressToken"])
+		require.Equal(t, map[string]any{"content": "done"}, next(t, firstReceived)["result"])
+		require.Equal(t, float64(7), next(t, secondReceived)["id"])
+		require.Empty(t, firstReceived)
+	})
+
+	t.Run("broadcasts notifications", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		_, firstReceived := attach(t, mux)
+		_, secondReceived := attach(t, mux)
+
+		changed, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "notifications/tools/list_changed"})
+		backend.simulateMessage(mcp.NewMessage(changed))
+
+		require.Equal(t, "notifications/tools/list_changed", next(t, firstReceived)["method"])
+		require.Equal(t, "notifications/tools/list_changed", next(t, secondReceived)["method"])
+	})
+
+	t.Run("routes server requests to the session of the related call", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		first, firstReceived := attach(t, mux)
+		second, secondReceived := attach(t, mux)
+
+		send(t, first, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": map[string]any{"_meta": map[string]any{"progressToken": "tok"}}})
+		token := lastSent(t, backend)["params"].(map[string]any)["_meta"].(map[string]any)["progressToken"]
+		send(t, second, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/call"})
+
+		sampling, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": "srv-1", "method": "sampling/createMessage", "params": map[string]any{"_meta": map[string]any{"progressToken": token}}})
+		backend.simulateMessage(mcp.NewMessage(sampling))
+		request := next(t, firstReceived)
+		require.Equal(t, "srv-1", request["id"])
+		require.Equal(t, "tok", request["params"].(map[string]any)["_meta"].(map[string]any)["progressToken"])
+		require.Empty(t, secondReceived)
+
+		// Both sessions have calls in flight, so an unrelated request is
+		// refused rather than guessed.
+		roots, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": "srv-2", "method": "roots/list"})
+		backend.simulateMessage(mcp.NewMessage(roots))
+		refused := lastSent(t, backend)
+		require.Equal(t, "srv-2", refused["id"])
+		require.NotNil(t, refused["error"])
+		require.Empty(t, firstReceived)
+		require.Empty(t, secondReceived)
+	})
+
+	t.Run("delivers resource updates and log messages to subscribers", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		first, firstReceived := attach(t, mux)
+		second, secondReceived := attach(t, mux)
+
+		send(t, first, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "resources/subscribe", "params": map[string]any{"uri": "file:///a"}})
+		reply(backend, lastSent(t, backend)["id"], map[string]any{})
+		next(t, firstReceived)
+		send(t, second, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "logging/setLevel", "params": map[string]any{"level": "error"}})
+		setLevel := lastSent(t, backend)
+		require.Equal(t, "error", setLevel["params"].(map[string]any)["level"])
+		reply(backend, setLevel["id"], map[string]any{})
+		next(t, secondReceived)
+		send(t, first, map[string]any{"jsonrpc": "2.0", "id": 2, "method": "logging/setLevel", "params": map[string]any{"level": "debug"}})
+		setLevel = lastSent(t, backend)
+		require.Equal(t, "debug", setLevel["params"].(map[string]any)["level"])
+		reply(backend, setLevel["id"], map[string]any{})
+		next(t, firstReceived)
+
+		updated, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "notifications/resources/updated", "params": map[string]any{"uri": "file:///a"}})
+		backend.simulateMessage(mcp.NewMessage(updated))
+		require.Equal(t, "notifications/resources/updated", next(t, firstReceived)["method"])
+		require.Empty(t, secondReceived)
+
+		info, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{"level": "info", "data": "fine"}})
+		backend.simulateMessage(mcp.NewMessage(info))
+		require.Equal(t, "info", next(t, firstReceived)["params"].(map[string]any)["level"])
+		require.Empty(t, secondReceived)
+
+		failure, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{"level": "error", "data": "broken"}})
+		backend.simulateMessage(mcp.NewMessage(failure))
+		require.Equal(t, "error", next(t, firstReceived)["params"].(map[string]any)["level"])
+		require.Equal(t, "error", next(t, secondReceived)["params"].(map[string]any)["level"])
+
+		// The backend is unsubscribed once the last subscriber leaves.
+		send(t, second, map[string]any{"jsonrpc": "2.0", "id": 2, "method": "resources/subscribe", "params": map[string]any{"uri": "file:///a"}})
+		reply(backend, lastSent(t, backend)["id"], map[string]any{})
+		next(t, secondReceived)
+		sent := len(backend.getMessages())
+		require.NoError(t, first.Close())
+		require.Len(t, backend.getMessages(), sent)
+		send(t, second, map[string]any{"jsonrpc": "2.0", "id": 3, "method": "resources/unsubscribe", "params": map[string]any{"uri": "file:///a"}})
+		unsubscribe := lastSent(t, backend)
+		require.Equal(t, "resources/unsubscribe", unsubscribe["method"])
+		require.Len(t, backend.getMessages(), sent+1)
+	})
+
+	t.Run("cancels outstanding requests when a connection closes", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		conn, received := attach(t, mux)
+		send(t, conn, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/call"})
+		forwarded := lastSent(t, backend)
+		require.NoError(t, conn.Close())
+
+		cancelled := lastSent(t, backend)
+		require.Equal(t, "notifications/cancelled", cancelled["method"])
+		require.Equal(t, forwarded["id"], cancelled["params"].(map[string]any)["requestId"])
+
+		reply(backend, forwarded["id"], map[string]any{})
+		require.Empty(t, received)
+		require.False(t, backend.closed)
+	})
+
+	t.Run("moves new connections to recycled backends", func(t *testing.T) {
+		old := newMockTransport()
+		mux := proxy.NewMux(old)
+		require.NoError(t, mux.Start(context.Background()))
+
+		attached, _ := attach(t, mux)
+		fresh := newMockTransport()
+		require.NoError(t, mux.Recycle(context.Background(), fresh))
+
+		// The attached session keeps its backend.
+		send(t, attached, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/list"})
+		require.Len(t, old.getMessages(), 1)
+		require.False(t, old.closed)
+
+		conn, _ := attach(t, mux)
+		send(t, conn, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/list"})
+		require.Len(t, fresh.getMessages(), 1)
+
+		// The old backend is closed once its last session leaves.
+		require.NoError(t, attached.Close())
+		old.mu.RLock()
+		closed := old.closed
+		old.mu.RUnlock()
+		require.True(t, closed)
+		require.NoError(t, conn.Close())
+		require.False(t, fresh.closed)
+	})
+
+	t.Run("closes connections when the backend exits", func(t *testing.T) {
+		backend := newMockTransport()
+		mux := proxy.NewMux(backend)
+		require.NoError(t, mux.Start(context.Background()))
+
+		conn, _ := attach(t, mux)
+		closed := make(chan struct{})
+		conn.OnClose(func() { close(closed) })
+
+		require.NoError(t, mux.Close())
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("connection was not closed")
+		}
+
+		_, err := mux.Attach()
+		require.Error(t, err)
+	})
+}
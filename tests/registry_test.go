@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sabbour/mcp-proxy-go/internal/registry"
+)
+
+func TestFileRegistry(t *testing.T) {
+	t.Run("registers and forgets sessions", func(t *testing.T) {
+		sessions, err := registry.NewFile(t.TempDir())
+		require.NoError(t, err)
+
+		require.NoError(t, sessions.Register("s1", "http://a:3000"))
+		require.NoError(t, sessions.Register("s2", "http://b:3000"))
+		owner, err := sessions.Lookup("s1")
+		require.NoError(t, err)
+		require.Equal(t, "http://a:3000", owner)
+
+		require.NoError(t, sessions.Unregister("s1"))
+		require.NoError(t, sessions.Unregister("s1"), "unregistering twice is fine")
+		owner, err = sessions.Lookup("s1")
+		require.NoError(t, err)
+		require.Empty(t, owner)
+	})
+
+	t.Run("removes the sessions of an owner", func(t *testing.T) {
+		dir := t.TempDir()
+		sessions, err := registry.NewFile(dir)
+		require.NoError(t, err)
+		require.NoError(t, sessions.Register("s1", "http://a:3000"))
+		require.NoError(t, sessions.Register("s2", "http://a:3000"))
+		require.NoError(t, sessions.Register("s3", "http://b:3000"))
+
+		// Replicas share the directory.
+		restarted, err := registry.NewFile(dir)
+		require.NoError(t, err)
+		removed, err := restarted.RemoveOwner("http://a:3000")
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+
+		owner, err := sessions.Lookup("s3")
+		require.NoError(t, err)
+		require.Equal(t, "http://b:3000", owner)
+	})
+
+	t.Run("rejects session ids outside the directory", func(t *testing.T) {
+		sessions, err := registry.NewFile(t.TempDir())
+		require.NoError(t, err)
+
+		for _, id := range []string{"", "../escape", "a/b", ".hidden"} {
+			_, err := sessions.Lookup(id)
+			require.Error(t, err, id)
+			require.Error(t, sessions.Register(id, "http://a:3000"), id)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -56,4 +57,193 @@ func TestStdioClientBasicLifecycle(t *testing.T) {
 		err = client.Close()
 		require.NoError(t, err)
 	})
-}
\ No newline at end of file
+}
+
+func TestStdioSupervisor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stdio integration test in short mode")
+	}
+
+	params := stdio.Params{
+		Command: "go",
+		Args:    []string{"run", "./fixtures/simple_stdio_server.go"},
+		Dir:     projectRoot(t),
+	}
+
+	t.Run("restarts a crashed server and replays initialize", func(t *testing.T) {
+		supervisor := stdio.NewSupervisor(params, stdio.SupervisorOptions{InitialBackoff: 10 * time.Millisecond})
+		client := mcp.NewClient(supervisor)
+
+		closed := make(chan struct{})
+		client.OnClose(func() { close(closed) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		require.NoError(t, client.Start(ctx))
+		t.Cleanup(func() { _ = client.Close() })
+
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "initialize", map[string]any{}, nil))
+		require.NoError(t, client.Notify(ctx, "notifications/initialized", nil))
+
+		// The request in flight when the process dies fails with an error.
+		err := client.BlockingCall(ctx, 10*time.Second, "test/crash", nil, nil)
+		require.ErrorContains(t, err, "process exited")
+
+		var result struct {
+			Resources []map[string]any `json:"resources"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 20*time.Second, "resources/list", nil, &result))
+		require.Len(t, result.Resources, 1)
+
+		select {
+		case <-closed:
+			t.Fatal("supervisor closed after a single crash")
+		default:
+		}
+	})
+
+	t.Run("gives up after too many restarts", func(t *testing.T) {
+		supervisor := stdio.NewSupervisor(params, stdio.SupervisorOptions{
+			InitialBackoff: 10 * time.Millisecond,
+			MaxRestarts:    1,
+		})
+		client := mcp.NewClient(supervisor)
+
+		closed := make(chan struct{})
+		client.OnClose(func() { close(closed) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		require.NoError(t, client.Start(ctx))
+
+		require.Error(t, client.BlockingCall(ctx, 10*time.Second, "test/crash", nil, nil))
+		require.Error(t, client.BlockingCall(ctx, 20*time.Second, "test/crash", nil, nil))
+
+		select {
+		case <-closed:
+		case <-time.After(10 * time.Second):
+			t.Fatal("supervisor did not give up")
+		}
+	})
+}
+
+func TestStdioPool(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stdio integration test in short mode")
+	}
+
+	params := stdio.Params{
+		Command: "go",
+		Args:    []string{"run", "./fixtures/simple_stdio_server.go"},
+		Dir:     projectRoot(t),
+	}
+	newTransport := func() mcp.Transport { return stdio.NewClient(params) }
+
+	waitWarm := func(t *testing.T, pool *stdio.Pool, n int) {
+		require.Eventually(t, func() bool { return pool.Stats().Warm == n }, 20*time.Second, 10*time.Millisecond)
+	}
+
+	t.Run("pre-initializes with the params of the latest client", func(t *testing.T) {
+		pool := stdio.NewPool(newTransport, stdio.PoolOptions{Size: 1, Initialize: true})
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Close() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		session := func(t *testing.T, params map[string]any) {
+			waitWarm(t, pool, 1)
+			transport, err := pool.Get(context.Background())
+			require.NoError(t, err)
+			client := mcp.NewClient(transport)
+			require.NoError(t, client.Start(ctx))
+			t.Cleanup(func() { _ = client.Close() })
+
+			var initResult struct {
+				ServerInfo map[string]any `json:"serverInfo"`
+			}
+			require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "initialize", params, &initResult))
+			require.Equal(t, "example-server", initResult.ServerInfo["name"])
+			require.NoError(t, client.Notify(ctx, "notifications/initialized", nil))
+
+			var result struct {
+				Resources []map[string]any `json:"resources"`
+			}
+			require.NoError(t, client.BlockingCall(ctx, 5*time.Second, "resources/list", nil, &result))
+			require.Len(t, result.Resources, 1)
+		}
+
+		params := map[string]any{"protocolVersion": "2025-06-18", "capabilities": map[string]any{"roots": map[string]any{}}}
+
+		// The first client teaches the pool its params; a process warmed
+		// after that answers the same params from its handshake.
+		session(t, params)
+		session(t, params)
+		session(t, params)
+		require.NotZero(t, pool.Stats().Initialized)
+		initialized := pool.Stats().Initialized
+
+		// A client with other capabilities gets a fresh process.
+		session(t, map[string]any{"protocolVersion": "2025-06-18", "capabilities": map[string]any{}})
+		stats := pool.Stats()
+		require.Equal(t, initialized, stats.Initialized)
+		require.Equal(t, uint64(1), stats.Misses)
+		require.Equal(t, uint64(3), stats.Hits)
+	})
+
+	t.Run("replaces warm processes on flush", func(t *testing.T) {
+		var built atomic.Int32
+		exited := make(chan int32, 4)
+		pool := stdio.NewPool(func() mcp.Transport {
+			n := built.Add(1)
+			client := stdio.NewClient(params)
+			client.OnExit(func(stdio.ExitStatus) { exited <- n })
+			return client
+		}, stdio.PoolOptions{Size: 1})
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Close() })
+		waitWarm(t, pool, 1)
+
+		require.NoError(t, pool.Flush())
+		select {
+		case n := <-exited:
+			require.Equal(t, int32(1), n)
+		case <-time.After(10 * time.Second):
+			t.Fatal("warm process was not closed")
+		}
+
+		waitWarm(t, pool, 1)
+		require.Equal(t, int32(2), built.Load())
+		require.Equal(t, 1, pool.Stats().Running)
+	})
+
+	t.Run("enforces the process cap", func(t *testing.T) {
+		pool := stdio.NewPool(newTransport, stdio.PoolOptions{Size: 1, MaxProcesses: 2})
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Close() })
+		waitWarm(t, pool, 1)
+
+		first, err := pool.Get(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, first.Start(context.Background()))
+
+		// The filler starts a second process, which reaches the cap.
+		waitWarm(t, pool, 1)
+		second, err := pool.Get(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, second.Start(context.Background()))
+		t.Cleanup(func() { _ = second.Close() })
+
+		_, err = pool.Get(context.Background())
+		require.ErrorIs(t, err, stdio.ErrPoolExhausted)
+
+		// Closing a process frees a slot.
+		require.NoError(t, first.Close())
+		waitWarm(t, pool, 1)
+		third, err := pool.Get(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, third.Close())
+		require.Equal(t, uint64(3), pool.Stats().Hits)
+	})
+}
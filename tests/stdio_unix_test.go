@@ -0,0 +1,181 @@
+//go:build linux
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/stdio"
+)
+
+func TestStdioClientTermination(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stdio integration test in short mode")
+	}
+
+	t.Run("terminates grandchildren in the process group", func(t *testing.T) {
+		client := stdio.NewClient(stdio.Params{
+			Command: "sh",
+			Args:    []string{"-c", `sleep 60 & echo "{\"pid\": $!}"; wait`},
+		})
+
+		pids := make(chan int, 1)
+		client.OnMessage(func(msg mcp.Message) {
+			var body struct {
+				PID int `json:"pid"`
+			}
+			if json.Unmarshal(msg.Bytes(), &body) == nil {
+				pids <- body.PID
+			}
+		})
+		exits := make(chan stdio.ExitStatus, 1)
+		client.OnExit(func(status stdio.ExitStatus) { exits <- status })
+
+		require.NoError(t, client.Start(context.Background()))
+
+		var grandchild int
+		select {
+		case grandchild = <-pids:
+		case <-time.After(5 * time.Second):
+			t.Fatal("did not receive grandchild pid")
+		}
+
+		require.NoError(t, client.Close())
+
+		status := <-exits
+		require.Equal(t, "terminated", status.Signal)
+		require.Eventually(t, func() bool { return processGone(grandchild) }, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("escalates to SIGKILL after the timeout", func(t *testing.T) {
+		client := stdio.NewClient(stdio.Params{
+			Command:          "sh",
+			Args:             []string{"-c", `trap "" TERM; echo "{}"; while true; do sleep 0.1; done`},
+			TerminateTimeout: 200 * time.Millisecond,
+		})
+
+		started := make(chan struct{}, 1)
+		client.OnMessage(func(mcp.Message) { started <- struct{}{} })
+		exits := make(chan stdio.ExitStatus, 1)
+		client.OnExit(func(status stdio.ExitStatus) { exits <- status })
+
+		require.NoError(t, client.Start(context.Background()))
+		<-started
+
+		begin := time.Now()
+		require.NoError(t, client.Close())
+		require.GreaterOrEqual(t, time.Since(begin), 200*time.Millisecond)
+
+		status := <-exits
+		require.Equal(t, "killed", status.Signal)
+		require.Equal(t, -1, status.Code)
+	})
+
+	t.Run("kills grandchildren that outlive the leader", func(t *testing.T) {
+		client := stdio.NewClient(stdio.Params{
+			Command:          "sh",
+			Args:             []string{"-c", `sh -c 'trap "" TERM; echo "{\"pid\": $$}"; while true; do sleep 0.1; done' & wait`},
+			TerminateTimeout: 200 * time.Millisecond,
+		})
+
+		pids := make(chan int, 1)
+		client.OnMessage(func(msg mcp.Message) {
+			var body struct {
+				PID int `json:"pid"`
+			}
+			if json.Unmarshal(msg.Bytes(), &body) == nil {
+				pids <- body.PID
+			}
+		})
+
+		require.NoError(t, client.Start(context.Background()))
+
+		var grandchild int
+		select {
+		case grandchild = <-pids:
+		case <-time.After(5 * time.Second):
+			t.Fatal("did not receive grandchild pid")
+		}
+
+		// The leader exits on SIGTERM; the grandchild ignores it.
+		require.NoError(t, client.Close())
+		require.False(t, processGone(grandchild))
+		require.Eventually(t, func() bool { return processGone(grandchild) }, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("supervisor closed during a restart leaves no process", func(t *testing.T) {
+		for i := 0; i < 40; i++ {
+			supervisor := stdio.NewSupervisor(stdio.Params{
+				Command: "sh",
+				Args:    []string{"-c", `echo "{\"pid\": $$}"; exec sleep 60`},
+			}, stdio.SupervisorOptions{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+			pids := make(chan int, 4)
+			supervisor.OnMessage(func(msg mcp.Message) {
+				var body struct {
+					PID int `json:"pid"`
+				}
+				if json.Unmarshal(msg.Bytes(), &body) == nil {
+					pids <- body.PID
+				}
+			})
+			exits := make(chan stdio.ExitStatus, 4)
+			supervisor.OnExit(func(status stdio.ExitStatus) { exits <- status })
+			require.NoError(t, supervisor.Start(context.Background()))
+
+			// Crash the process and close around the time its replacement
+			// starts.
+			first := <-pids
+			require.NoError(t, syscall.Kill(first, syscall.SIGKILL))
+			<-exits
+			time.Sleep(time.Duration(i%10) * 200 * time.Microsecond)
+			require.NoError(t, supervisor.Close())
+
+			time.Sleep(50 * time.Millisecond)
+			close(pids)
+			for pid := range pids {
+				require.Eventually(t, func() bool { return processGone(pid) }, time.Second, 20*time.Millisecond)
+			}
+		}
+	})
+
+	t.Run("reports the exit code", func(t *testing.T) {
+		client := stdio.NewClient(stdio.Params{
+			Command: "sh",
+			Args:    []string{"-c", "exit 3"},
+		})
+
+		exits := make(chan stdio.ExitStatus, 1)
+		client.OnExit(func(status stdio.ExitStatus) { exits <- status })
+		require.NoError(t, client.Start(context.Background()))
+
+		select {
+		case status := <-exits:
+			require.Equal(t, 3, status.Code)
+			require.Empty(t, status.Signal)
+		case <-time.After(5 * time.Second):
+			t.Fatal("exit status not reported")
+		}
+	})
+}
+
+// processGone reports whether pid no longer runs. Orphans may linger as
+// zombies when nothing reaps them, which counts as gone.
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
@@ -0,0 +1,379 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sabbour/mcp-proxy-go/internal/httpserver"
+	"github.com/sabbour/mcp-proxy-go/internal/mcp"
+	"github.com/sabbour/mcp-proxy-go/internal/websocket"
+)
+
+func TestWebSocketTransport(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{APIKey: "secret"})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+	wsURL := "ws" + strings.TrimPrefix(baseURL, "http") + "/ws"
+
+	t.Run("initializes and calls the server", func(t *testing.T) {
+		transport := websocket.NewTransport(websocket.TransportOptions{
+			URL:    wsURL,
+			Header: http.Header{"X-Api-Key": []string{"secret"}},
+		})
+		client := mcp.NewClient(transport)
+		require.NoError(t, client.Start(context.Background()))
+		t.Cleanup(func() { _ = client.Close() })
+		require.NotEmpty(t, transport.SessionID())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "initialize", map[string]any{}, nil))
+		require.NoError(t, client.Notify(ctx, "notifications/initialized", nil))
+
+		var result struct {
+			Content []map[string]any `json:"content"`
+		}
+		require.NoError(t, client.BlockingCall(ctx, 10*time.Second, "tools/call", map[string]any{}, &result))
+		require.Equal(t, "done", result.Content[0]["text"])
+	})
+
+	t.Run("rejects unauthenticated upgrades", func(t *testing.T) {
+		_, resp, err := websocket.Dial(context.Background(), wsURL, websocket.DialOptions{})
+		require.Error(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("rejects plain requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, baseURL+"/ws", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestWebSocketServerRequests(t *testing.T) {
+	answers := make(chan mcp.Response, 1)
+	backend := newScriptedTransport(func(tr *scriptedTransport, req mcp.Request) {
+		if req.Method != "tools/call" {
+			tr.reply(req.ID, map[string]any{})
+			return
+		}
+		tr.emit(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      "srv-1",
+			"method":  "sampling/createMessage",
+		})
+		answer := <-answers
+		tr.reply(req.ID, map[string]any{"sampled": json.RawMessage(answer.Result)})
+	})
+	backend.onResponse = func(resp mcp.Response) { answers <- resp }
+
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) { return backend, nil },
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	conn, resp, err := websocket.Dial(context.Background(), baseURL+"/ws", websocket.DialOptions{
+		Subprotocols: []string{websocket.Subprotocol},
+	})
+	require.NoError(t, err)
+	defer conn.Close(websocket.CloseNormal, "")
+	require.Equal(t, websocket.Subprotocol, conn.Subprotocol())
+	require.NotEmpty(t, resp.Header.Get("mcp-session-id"))
+
+	require.NoError(t, conn.WriteMessage(websocket.OpText, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`)))
+
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Contains(t, string(data), "sampling/createMessage")
+
+	require.NoError(t, conn.WriteMessage(websocket.OpText, []byte(`{"jsonrpc":"2.0","id":"srv-1","result":"hello"}`)))
+
+	_, data, err = conn.ReadMessage()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{"sampled":"hello"}}`, string(data))
+}
+
+func TestWebSocketKeepalive(t *testing.T) {
+	closed := make(chan httpserver.CloseReason, 1)
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) {
+			return newScriptedTransport(func(*scriptedTransport, mcp.Request) {}), nil
+		},
+		WebSocketPingInterval: 50 * time.Millisecond,
+		OnClose: func(_ string, reason httpserver.CloseReason) {
+			closed <- reason
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	t.Run("keeps a responsive client connected", func(t *testing.T) {
+		transport := websocket.NewTransport(websocket.TransportOptions{
+			URL:          baseURL + "/ws",
+			PingInterval: 50 * time.Millisecond,
+		})
+		require.NoError(t, transport.Start(context.Background()))
+
+		// The client reader answers the server's pings, so the connection
+		// outlives several idle timeouts.
+		time.Sleep(300 * time.Millisecond)
+		require.NoError(t, transport.Send(context.Background(), mcp.NewMessage([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))))
+		select {
+		case reason := <-closed:
+			t.Fatalf("session closed early: %s", reason)
+		default:
+		}
+
+		require.NoError(t, transport.Close())
+		select {
+		case reason := <-closed:
+			require.Equal(t, httpserver.CloseReasonClient, reason)
+		case <-time.After(5 * time.Second):
+			t.Fatal("session was not closed")
+		}
+	})
+
+	t.Run("drops a silent client", func(t *testing.T) {
+		// Without a reader the client never answers pings.
+		conn, _, err := websocket.Dial(context.Background(), baseURL+"/ws", websocket.DialOptions{})
+		require.NoError(t, err)
+		defer conn.Close(websocket.CloseNormal, "")
+
+		select {
+		case reason := <-closed:
+			require.Equal(t, httpserver.CloseReasonClient, reason)
+		case <-time.After(5 * time.Second):
+			t.Fatal("silent client was not dropped")
+		}
+	})
+
+	t.Run("sends a shutdown notice", func(t *testing.T) {
+		conn, _, err := websocket.Dial(context.Background(), baseURL+"/ws", websocket.DialOptions{})
+		require.NoError(t, err)
+		defer conn.Close(websocket.CloseNormal, "")
+
+		go func() { _ = server.Close(context.Background()) }()
+
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Contains(t, string(data), "mcp-proxy/shutdown")
+
+		_, _, err = conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		require.True(t, errors.As(err, &closeErr), "unexpected error: %v", err)
+		require.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	})
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	server, baseURL := startTestServer(t, httpserver.Options{
+		CreateTransport: func(context.Context, *http.Request) (mcp.Transport, error) {
+			return newScriptedTransport(func(*scriptedTransport, mcp.Request) {}), nil
+		},
+		WebSocketOrigins: []string{"*.example.com"},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(context.Background()))
+	})
+
+	dial := func(origin string) (*http.Response, error) {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.Dial(context.Background(), baseURL+"/ws", websocket.DialOptions{Header: header})
+		if err == nil {
+			_ = conn.Close(websocket.CloseNormal, "")
+		}
+		return resp, err
+	}
+
+	for _, origin := range []string{"", baseURL, "https://app.example.com"} {
+		_, err := dial(origin)
+		require.NoError(t, err, "origin %q", origin)
+	}
+
+	for _, origin := range []string{"https://evil.test", "https://example.com.evil.test", "null"} {
+		resp, err := dial(origin)
+		require.Error(t, err, "origin %q", origin)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestWebSocketFraming(t *testing.T) {
+	t.Run("reassembles fragments around control frames", func(t *testing.T) {
+		conn, peer := dialRawPeer(t)
+
+		peer.write(t, false, websocket.OpText, []byte("hel"))
+		peer.write(t, true, websocket.OpPing, []byte("p"))
+		peer.write(t, true, websocket.OpContinuation, []byte("lo"))
+
+		op, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.OpText, op)
+		require.Equal(t, "hello", string(data))
+
+		op, payload := peer.read(t)
+		require.Equal(t, websocket.OpPong, op)
+		require.Equal(t, "p", string(payload))
+	})
+
+	t.Run("rejects fragmented control frames", func(t *testing.T) {
+		conn, peer := dialRawPeer(t)
+
+		peer.write(t, false, websocket.OpPing, nil)
+
+		_, _, err := conn.ReadMessage()
+		require.Error(t, err)
+		op, payload := peer.read(t)
+		require.Equal(t, websocket.OpClose, op)
+		require.Equal(t, websocket.CloseProtocolError, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("rejects a continuation without a message", func(t *testing.T) {
+		conn, peer := dialRawPeer(t)
+
+		peer.write(t, true, websocket.OpContinuation, []byte("x"))
+
+		_, _, err := conn.ReadMessage()
+		require.Error(t, err)
+		op, payload := peer.read(t)
+		require.Equal(t, websocket.OpClose, op)
+		require.Equal(t, websocket.CloseProtocolError, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("rejects messages over the size limit", func(t *testing.T) {
+		conn, peer := dialRawPeer(t)
+		conn.MaxMessageSize = 8
+
+		// Each fragment fits; the reassembled message does not.
+		peer.write(t, false, websocket.OpText, []byte("12345"))
+		peer.write(t, true, websocket.OpContinuation, []byte("67890"))
+
+		_, _, err := conn.ReadMessage()
+		require.Error(t, err)
+		op, payload := peer.read(t)
+		require.Equal(t, websocket.OpClose, op)
+		require.Equal(t, websocket.CloseMessageTooBig, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("acknowledges a close", func(t *testing.T) {
+		conn, peer := dialRawPeer(t)
+
+		peer.write(t, true, websocket.OpClose, append(binary.BigEndian.AppendUint16(nil, websocket.CloseGoingAway), "bye"...))
+
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		require.True(t, errors.As(err, &closeErr), "unexpected error: %v", err)
+		require.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+		require.Equal(t, "bye", closeErr.Reason)
+
+		op, payload := peer.read(t)
+		require.Equal(t, websocket.OpClose, op)
+		require.Equal(t, websocket.CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("fails writes to a peer that stops reading", func(t *testing.T) {
+		conn, _ := dialRawPeer(t)
+		conn.WriteTimeout = 100 * time.Millisecond
+
+		errs := make(chan error, 1)
+		go func() { errs <- conn.WriteMessage(websocket.OpText, make([]byte, 64<<20)) }()
+
+		select {
+		case err := <-errs:
+			require.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("write to a stalled peer did not time out")
+		}
+	})
+}
+
+// rawPeer is the server end of a connection made with websocket.Dial. It
+// writes unmasked frames and reads the masked frames of the client.
+type rawPeer struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialRawPeer answers the opening handshake by hand and returns both ends.
+func dialRawPeer(t *testing.T) (*websocket.Conn, *rawPeer) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	peers := make(chan *rawPeer, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			_ = conn.Close()
+			return
+		}
+		sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"))
+		peers <- &rawPeer{conn: conn, br: br}
+	}()
+
+	conn, _, err := websocket.Dial(context.Background(), "ws://"+ln.Addr().String()+"/ws", websocket.DialOptions{})
+	require.NoError(t, err)
+	peer := <-peers
+	t.Cleanup(func() {
+		_ = peer.conn.Close()
+		_ = conn.Close(websocket.CloseNormal, "")
+	})
+	return conn, peer
+}
+
+func (p *rawPeer) write(t *testing.T, fin bool, op int, payload []byte) {
+	first := byte(op)
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, byte(len(payload))}
+	_, err := p.conn.Write(append(frame, payload...))
+	require.NoError(t, err)
+}
+
+func (p *rawPeer) read(t *testing.T) (int, []byte) {
+	_ = p.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header := make([]byte, 6)
+	_, err := io.ReadFull(p.br, header)
+	require.NoError(t, err)
+	require.NotZero(t, header[1]&0x80, "client frames must be masked")
+	payload := make([]byte, header[1]&0x7f)
+	_, err = io.ReadFull(p.br, payload)
+	require.NoError(t, err)
+	for i := range payload {
+		payload[i] ^= header[2+i%4]
+	}
+	return int(header[0] & 0x0f), payload
+}